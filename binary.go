@@ -0,0 +1,62 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// readFullAt fills buf from offset, a short read is io.ErrUnexpectedEOF
+func (r *Reader) readFullAt(buf []byte, offset int64) error {
+	n, err := r.ReadAt(buf, offset)
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadUint16At decodes the uint16 stored at offset
+func (r *Reader) ReadUint16At(offset int64, order binary.ByteOrder) (uint16, error) {
+	var buf [2]byte
+	if err := r.readFullAt(buf[:], offset); err != nil {
+		return 0, err
+	}
+	return order.Uint16(buf[:]), nil
+}
+
+// ReadUint32At decodes the uint32 stored at offset
+func (r *Reader) ReadUint32At(offset int64, order binary.ByteOrder) (uint32, error) {
+	var buf [4]byte
+	if err := r.readFullAt(buf[:], offset); err != nil {
+		return 0, err
+	}
+	return order.Uint32(buf[:]), nil
+}
+
+// ReadUint64At decodes the uint64 stored at offset
+func (r *Reader) ReadUint64At(offset int64, order binary.ByteOrder) (uint64, error) {
+	var buf [8]byte
+	if err := r.readFullAt(buf[:], offset); err != nil {
+		return 0, err
+	}
+	return order.Uint64(buf[:]), nil
+}
+
+// ReadStructAt decodes the fixed-size value stored at offset into v, a
+// pointer to a struct, array or number as taken by binary.Read, fetching
+// exactly binary.Size(v) bytes
+func (r *Reader) ReadStructAt(offset int64, order binary.ByteOrder, v interface{}) error {
+	size := binary.Size(v)
+	if size < 0 {
+		return fmt.Errorf("ReadStructAt: %T is not a fixed-size value", v)
+	}
+	buf := make([]byte, size)
+	if err := r.readFullAt(buf, offset); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(buf), order, v)
+}
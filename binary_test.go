@@ -0,0 +1,66 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestReadUintAt(t *testing.T) {
+	file := make([]byte, 32)
+	binary.LittleEndian.PutUint16(file[0:], 0xbeef)
+	binary.BigEndian.PutUint32(file[2:], 0xdeadbeef)
+	binary.LittleEndian.PutUint64(file[6:], 0x0123456789abcdef)
+	binary.BigEndian.PutUint64(file[14:], 0x0123456789abcdef)
+	s, _ := newServer(t, file)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.ReadUint16At(0, binary.LittleEndian); err != nil || v != 0xbeef {
+		t.Errorf("uint16 %#x, %v", v, err)
+	}
+	if v, err := r.ReadUint32At(2, binary.BigEndian); err != nil || v != 0xdeadbeef {
+		t.Errorf("uint32 %#x, %v", v, err)
+	}
+	if v, err := r.ReadUint64At(6, binary.LittleEndian); err != nil || v != 0x0123456789abcdef {
+		t.Errorf("little endian uint64 %#x, %v", v, err)
+	}
+	if v, err := r.ReadUint64At(14, binary.BigEndian); err != nil || v != 0x0123456789abcdef {
+		t.Errorf("big endian uint64 %#x, %v", v, err)
+	}
+	if _, err := r.ReadUint64At(28, binary.BigEndian); err != io.ErrUnexpectedEOF {
+		t.Errorf("read past the end: %v", err)
+	}
+}
+
+func TestReadStructAt(t *testing.T) {
+	type header struct {
+		Magic   [4]byte
+		Version uint16
+		Flags   uint16
+		Length  int64
+	}
+	want := header{Magic: [4]byte{'U', 'R', 'S', 'K'}, Version: 3, Flags: 0x8001, Length: -42}
+	var file bytes.Buffer
+	file.Write(make([]byte, 100))
+	if err := binary.Write(&file, binary.BigEndian, want); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newServer(t, file.Bytes())
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got header
+	if err := r.ReadStructAt(100, binary.BigEndian, &got); err != nil || got != want {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	if err := r.ReadStructAt(110, binary.BigEndian, &got); err != io.ErrUnexpectedEOF {
+		t.Fatalf("read past the end: %v", err)
+	}
+	if err := r.ReadStructAt(0, binary.BigEndian, &struct{ Name string }{}); err == nil {
+		t.Fatal("decoded a string, want an error for a value of no fixed size")
+	}
+}
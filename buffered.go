@@ -0,0 +1,111 @@
+package urlreadseeker
+
+import "io"
+
+// defaultMaxReadAhead caps the buffer of Buffered without WithMaxReadAhead
+const defaultMaxReadAhead = 8 * 1024 * 1024
+
+// bufferedReader keeps a read buffer in front of a Reader. Unlike bufio it
+// stays seekable: seeking drops the buffer and moves the underlying reader
+type bufferedReader struct {
+	r     *Reader
+	buf   []byte
+	start int64 // file offset of buf[0]
+	pos   int64
+	err   error // error from the fill that produced buf
+
+	// window is the size of the next fill, it doubles from size up to max
+	// while reads stay sequential
+	size, window, max int
+}
+
+// Buffered wraps the reader so sequential reads are served from a buffer,
+// each refill costing one request. The buffer starts at size bytes and
+// doubles with every refill that follows on from the last, up to the
+// WithMaxReadAhead cap, so long scans need ever fewer requests. Seek
+// invalidates the buffer and shrinks it back to size
+func (r *Reader) Buffered(size int) io.ReadSeeker {
+	max := r.maxReadAhead
+	if max <= 0 {
+		max = defaultMaxReadAhead
+	}
+	if max < size {
+		max = size
+	}
+	return &bufferedReader{
+		r:      r,
+		buf:    make([]byte, 0, size),
+		start:  r.offset,
+		pos:    r.offset,
+		size:   size,
+		window: size,
+		max:    max,
+	}
+}
+
+func (b *bufferedReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.pos < b.start || b.pos >= b.start+int64(len(b.buf)) {
+		if b.err != nil && b.pos == b.start+int64(len(b.buf)) {
+			return 0, b.err
+		}
+		if len(p) >= b.window {
+			// Too big to be worth buffering
+			n, err = b.r.ReadAt(p, b.pos)
+			b.advance(n)
+			return n, err
+		}
+		b.fill()
+		if len(b.buf) == 0 {
+			return 0, b.err
+		}
+	}
+
+	n = copy(p, b.buf[b.pos-b.start:])
+	b.advance(n)
+	return n, nil
+}
+
+// fill refills the buffer starting at the current position, growing the
+// window when it carries on where the last fill ended
+func (b *bufferedReader) fill() {
+	if len(b.buf) > 0 && b.pos == b.start+int64(len(b.buf)) {
+		b.window *= 2
+		if b.window > b.max {
+			b.window = b.max
+		}
+	}
+	if cap(b.buf) < b.window {
+		b.buf = make([]byte, b.window)
+	}
+	b.buf = b.buf[:b.window]
+	n, err := b.r.ReadAt(b.buf, b.pos)
+	b.buf = b.buf[:n]
+	b.start = b.pos
+	b.err = err
+}
+
+// advance moves the position forward, keeping the underlying reader in step
+func (b *bufferedReader) advance(n int) {
+	b.pos += int64(n)
+	b.r.mu.Lock()
+	b.r.offset = b.pos
+	b.r.consumed += int64(n)
+	b.r.mu.Unlock()
+}
+
+func (b *bufferedReader) Seek(offset int64, whence int) (int64, error) {
+	b.r.setOffset(b.pos)
+	pos, err := b.r.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	b.pos = pos
+	b.buf = b.buf[:0]
+	b.start = pos
+	b.err = nil
+	b.window = b.size
+	return pos, nil
+}
@@ -0,0 +1,71 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBufferedSeeks(t *testing.T) {
+	data := testData(100000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	b := r.Buffered(4096)
+	buf := make([]byte, 100)
+	pos := int64(0)
+	for i := 0; i < 20; i++ {
+		if i%5 == 0 {
+			pos = int64(i) * 4000
+			if _, err := b.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := io.ReadFull(b, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[pos:pos+100]) {
+			t.Fatalf("read %d at %d got the wrong bytes", i, pos)
+		}
+		pos += 100
+	}
+	// 4 seeks, each followed by one fill covering the next 5 reads
+	if got := atomic.LoadInt64(requests) - before; got != 4 {
+		t.Fatalf("%d requests for 20 reads, want 4", got)
+	}
+}
+
+func TestBufferedGrowsWindow(t *testing.T) {
+	data := testData(1 << 20)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithMaxReadAhead(256*1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := r.Buffered(4096)
+	buf := make([]byte, 1024)
+	quarter := len(data) / 4
+	var perQuarter []int64
+	last := atomic.LoadInt64(requests)
+	for pos := 0; pos < len(data); pos += len(buf) {
+		if _, err := io.ReadFull(b, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, data[pos:pos+len(buf)]) {
+			t.Fatalf("wrong bytes at %d", pos)
+		}
+		if (pos+len(buf))%quarter == 0 {
+			now := atomic.LoadInt64(requests)
+			perQuarter = append(perQuarter, now-last)
+			last = now
+		}
+	}
+	// Doubling from 4KB reaches the 256KB cap within the first quarter
+	if perQuarter[0] <= perQuarter[3] || perQuarter[3] > 1 {
+		t.Fatalf("requests per quarter of the scan %v, want them to drop", perQuarter)
+	}
+}
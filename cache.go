@@ -0,0 +1,405 @@
+package urlreadseeker
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultBlockSize is the granularity at which reads are cached
+const defaultBlockSize = 64 * 1024
+
+// warmConcurrency bounds the requests WarmCache runs at once
+const warmConcurrency = 4
+
+// Cache stores fetched blocks so they can be shared between readers.
+// Keys combine the url and the block offset, implementations may be
+// backed by anything (memory, disk, a distributed store) and must be
+// safe for concurrent use
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, data []byte)
+}
+
+// PeekingCache is a Cache that can report whether it holds a block without
+// that counting as a use, so EstimateRequests leaves it as it was. Caches
+// without it are assumed to hold nothing when estimating. MemoryCache and
+// LRUCache implement it
+type PeekingCache interface {
+	Cache
+	Contains(key string) bool
+}
+
+// MemoryCache is an unbounded in-memory Cache. It implements ExpiringCache,
+// expired blocks are dropped on the next Get
+type MemoryCache struct {
+	mu      sync.RWMutex
+	blocks  map[string][]byte
+	expires map[string]time.Time
+	bytes   int64
+}
+
+// NewMemoryCache creates an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{blocks: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+// Get returns the block stored under key
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	data, ok := c.blocks[key]
+	expires, expiring := c.expires[key]
+	c.mu.RUnlock()
+	if !expiring || time.Now().Before(expires) {
+		return data, ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if expires, expiring := c.expires[key]; expiring && !time.Now().Before(expires) {
+		c.bytes -= int64(len(c.blocks[key]))
+		delete(c.blocks, key)
+		delete(c.expires, key)
+	}
+	return nil, false
+}
+
+// Contains reports whether an unexpired block is stored under key, without
+// dropping it if it has expired
+func (c *MemoryCache) Contains(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.blocks[key]
+	expires, expiring := c.expires[key]
+	return ok && (!expiring || time.Now().Before(expires))
+}
+
+// Put stores data under key
+func (c *MemoryCache) Put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, data)
+	delete(c.expires, key)
+}
+
+// PutUntil stores data under key until expires
+func (c *MemoryCache) PutUntil(key string, data []byte, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, data)
+	c.expires[key] = expires
+}
+
+func (c *MemoryCache) put(key string, data []byte) {
+	c.bytes += int64(len(data)) - int64(len(c.blocks[key]))
+	c.blocks[key] = data
+}
+
+// Bytes returns the total size of the stored blocks
+func (c *MemoryCache) Bytes() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.bytes
+}
+
+// sizedCache is a private block cache, which Stats can measure
+type sizedCache interface {
+	Cache
+	Bytes() int64
+}
+
+// LRUCache is an in-memory Cache holding at most a fixed number of blocks,
+// evicting the least recently used. Like MemoryCache it implements
+// ExpiringCache
+type LRUCache struct {
+	mu        sync.Mutex
+	maxBlocks int
+	order     *list.List // of *lruEntry, most recently used first
+	entries   map[string]*list.Element
+	bytes     int64
+}
+
+type lruEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// NewLRUCache creates an empty LRUCache holding up to maxBlocks blocks
+func NewLRUCache(maxBlocks int) *LRUCache {
+	return &LRUCache{maxBlocks: maxBlocks, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get returns the block stored under key, marking it recently used
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.data, true
+}
+
+// Contains reports whether an unexpired block is stored under key, leaving
+// its place in the eviction order alone
+func (c *LRUCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return false
+	}
+	entry := elem.Value.(*lruEntry)
+	return entry.expires.IsZero() || time.Now().Before(entry.expires)
+}
+
+// Put stores data under key, evicting the least recently used block when
+// the cache is full
+func (c *LRUCache) Put(key string, data []byte) {
+	c.PutUntil(key, data, time.Time{})
+}
+
+// PutUntil stores data under key until expires, zero for no limit
+func (c *LRUCache) PutUntil(key string, data []byte, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, data: data, expires: expires})
+	c.bytes += int64(len(data))
+	for c.maxBlocks > 0 && c.order.Len() > c.maxBlocks {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRUCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.data))
+}
+
+// Bytes returns the total size of the stored blocks
+func (c *LRUCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// ReleaseCache drops the head and any private block cache to reclaim memory,
+// keeping the size and other metadata, later reads fetch again. The cache of
+// WithBlockCache is emptied rather than dropped. A cache given
+// to WithSharedCache belongs to the caller and is left alone, as is the
+// payload of a data: url
+func (r *Reader) ReleaseCache() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inline && isDataURL(r.url) {
+		return
+	}
+	r.head = []byte{}
+	r.inline = false
+	if r.privateCache != nil {
+		r.cache = nil
+		r.privateCache = nil
+	}
+	if r.lruBlocks > 0 {
+		// WithBlockCache keeps caching, starting over empty
+		r.privateCache = NewLRUCache(r.lruBlocks)
+		r.cache = r.privateCache
+	}
+}
+
+// blockKey identifies the block starting at start for this reader's url,
+// and for the version of the file once RefreshSize has seen it change
+func (r *Reader) blockKey(start int64) string {
+	if r.keyVersion != "" {
+		return fmt.Sprintf("%s#%s@%d", r.key, r.keyVersion, start)
+	}
+	return fmt.Sprintf("%s@%d", r.key, start)
+}
+
+// blockLen is the expected length of the block starting at start,
+// only the final block of the file is short
+func (r *Reader) blockLen(start int64) int64 {
+	if start+r.blockSize > r.contentSize {
+		return r.contentSize - start
+	}
+	return r.blockSize
+}
+
+// block returns the cached block starting at start, fetching and storing it
+// on a miss
+func (r *Reader) block(ctx context.Context, start int64) ([]byte, error) {
+	key := r.blockKey(start)
+	data, ok := r.cache.Get(key)
+	r.cacheLookup(ok)
+	if ok {
+		return data, nil
+	}
+	data, policy, err := r.fetchPolicy(ctx, start, start+r.blockLen(start))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) == r.blockLen(start) {
+		r.cachePut(key, data, policy)
+	}
+	return data, nil
+}
+
+// WarmCache fetches the blocks covering ranges concurrently and stores them
+// in the block cache so later reads of those regions make no requests. The
+// reader needs WithSharedCache or WithBlockCache, otherwise ErrNoCache is
+// returned. Ranges needing more blocks than WithBlockCache holds return
+// ErrCacheBudget without fetching anything, they would evict each other. So
+// do ranges starting before 0, with ErrNegativeOffset, and ranges ending
+// before they start or starting past the end of the file, with
+// ErrRangeOutOfBounds. Ranges running past the end are cut short
+func (r *Reader) WarmCache(ranges []Range) error {
+	if r.inline {
+		return nil
+	}
+	if r.cache == nil {
+		return ErrNoCache
+	}
+
+	starts := []int64{}
+	seen := map[int64]bool{}
+	for _, rg := range ranges {
+		if rg.Start < 0 {
+			return fmt.Errorf("%w: range %d-%d", ErrNegativeOffset, rg.Start, rg.End)
+		}
+		if rg.End < rg.Start || r.contentSize >= 0 && rg.Start > r.contentSize {
+			return fmt.Errorf("%w: range %d-%d of %d bytes", ErrRangeOutOfBounds, rg.Start, rg.End, r.contentSize)
+		}
+		end := rg.End
+		if end > r.contentSize {
+			end = r.contentSize
+		}
+		for start := rg.Start / r.blockSize * r.blockSize; start < end; start += r.blockSize {
+			if !seen[start] {
+				seen[start] = true
+				starts = append(starts, start)
+			}
+		}
+	}
+	if r.lruBlocks > 0 && len(starts) > r.lruBlocks {
+		return fmt.Errorf("%w: %d blocks to warm, the cache holds %d", ErrCacheBudget, len(starts), r.lruBlocks)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(starts))
+	sem := make(chan struct{}, warmConcurrency)
+	for _, start := range starts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(start int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := r.block(r.ctx, start); err != nil {
+				errs <- err
+			}
+		}(start)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// readBlocks serves a read block by block from the cache. Missing blocks
+// are fetched with a single contiguous range request and stored, along
+// with up to WithBlockReadAhead blocks following them
+func (r *Reader) readBlocks(ctx context.Context, buf []byte, offset int64) (n int, err error) {
+	end := offset + int64(len(buf))
+	if end > r.contentSize {
+		end = r.contentSize
+	}
+	first := offset / r.blockSize * r.blockSize
+	blocks := [][]byte{}
+	missFrom, missTo := int64(-1), int64(-1)
+	for start := first; start < end; start += r.blockSize {
+		data, ok := r.cache.Get(r.blockKey(start))
+		r.cacheLookup(ok)
+		if !ok {
+			if missFrom < 0 {
+				missFrom = start
+			}
+			missTo = start + r.blockLen(start)
+		}
+		blocks = append(blocks, data)
+	}
+
+	if missFrom >= 0 {
+		readTo := missTo
+		missTo = r.readAhead(missTo)
+		body, policy, err := r.fetchPolicy(ctx, missFrom, missTo)
+		if err != nil {
+			return 0, err
+		}
+		r.storeAhead(body, missFrom, readTo, missTo, policy)
+		for i := range blocks {
+			start := first + int64(i)*r.blockSize
+			if blocks[i] != nil || start < missFrom || start >= missTo {
+				continue
+			}
+			pos := start - missFrom
+			if pos >= int64(len(body)) {
+				break
+			}
+			stop := pos + r.blockLen(start)
+			if stop > int64(len(body)) {
+				// Short body, use what arrived but don't cache a partial block
+				blocks[i] = body[pos:]
+				continue
+			}
+			blocks[i] = body[pos:stop]
+			r.cachePut(r.blockKey(start), blocks[i], policy)
+		}
+	}
+
+	for i, data := range blocks {
+		pos := offset + int64(n) - (first + int64(i)*r.blockSize)
+		if pos >= int64(len(data)) {
+			break
+		}
+		n += copy(buf[n:], data[pos:])
+	}
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readAhead extends a fetch of missing blocks ending at to by up to
+// blockReadAhead of the blocks after it, stopping at the first one cached
+func (r *Reader) readAhead(to int64) int64 {
+	for i := 0; i < r.blockReadAhead && to < r.contentSize; i++ {
+		if _, ok := r.cache.Get(r.blockKey(to)); ok {
+			break
+		}
+		to += r.blockLen(to)
+	}
+	return to
+}
+
+// storeAhead caches the whole read-ahead blocks in [readTo, missTo) of a
+// body fetched from missFrom
+func (r *Reader) storeAhead(body []byte, missFrom, readTo, missTo int64, policy cachePolicy) {
+	for start := readTo; start < missTo; start += r.blockSize {
+		pos, stop := start-missFrom, start-missFrom+r.blockLen(start)
+		if stop > int64(len(body)) {
+			return
+		}
+		r.cachePut(r.blockKey(start), body[pos:stop], policy)
+	}
+}
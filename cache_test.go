@@ -0,0 +1,186 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSharedCache(t *testing.T) {
+	data := testData(200000)
+	s, _ := newServer(t, data)
+	c := NewMemoryCache()
+	r1, err := NewReader(s.URL, 0, WithSharedCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100000)
+	if n, err := r1.ReadAt(buf, 50000); err != nil || !bytes.Equal(buf[:n], data[50000:150000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	r2, err := NewReader(s.URL, 0, WithSharedCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := r2.Stats().Requests
+	small := make([]byte, 1000)
+	if n, err := r2.ReadAt(small, 70000); err != nil || !bytes.Equal(small[:n], data[70000:71000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if r2.Stats().Requests != before {
+		t.Fatal("second reader missed the shared cache")
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	data := testData(1000000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithSharedCache(NewMemoryCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WarmCache([]Range{{100, 200000}, {800000, 900000}}); err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	buf := make([]byte, 50000)
+	for _, off := range []int64{820000, 100000} {
+		if n, err := r.ReadAt(buf, off); err != nil || !bytes.Equal(buf[:n], data[off:off+50000]) {
+			t.Fatalf("read at %d: %d, %v", off, n, err)
+		}
+	}
+	if atomic.LoadInt64(requests) != before {
+		t.Fatal("read of a warmed region hit the server")
+	}
+}
+
+func TestWarmCacheBudget(t *testing.T) {
+	s, _ := newServer(t, testData(100000))
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WarmCache([]Range{{0, 10}}); err != ErrNoCache {
+		t.Fatalf("got %v without a cache, want ErrNoCache", err)
+	}
+	r, err = NewReader(s.URL, 0, WithBlockCache(1000, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WarmCache([]Range{{0, 10000}}); !errors.Is(err, ErrCacheBudget) {
+		t.Fatalf("got %v for 10 blocks, want ErrCacheBudget", err)
+	}
+	if err := r.WarmCache([]Range{{0, 10}, {5000, 5010}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarmCacheBounds(t *testing.T) {
+	s, requests := newServer(t, testData(10000))
+	r, err := NewReader(s.URL, 0, WithBlockCache(1000, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	if err := r.WarmCache([]Range{{0, 10}, {-500, 100}}); !errors.Is(err, ErrNegativeOffset) {
+		t.Fatalf("got %v for a negative start, want ErrNegativeOffset", err)
+	}
+	for _, rg := range []Range{{20000, 20010}, {500, 100}} {
+		if err := r.WarmCache([]Range{rg}); !errors.Is(err, ErrRangeOutOfBounds) {
+			t.Fatalf("got %v for %v, want ErrRangeOutOfBounds", err, rg)
+		}
+	}
+	if n := atomic.LoadInt64(requests); n != before {
+		t.Fatalf("sent %d requests for bad ranges", n-before)
+	}
+	if err := r.WarmCache([]Range{{9500, 20000}}); err != nil {
+		t.Fatalf("got %v for a range past the end, want it cut short", err)
+	}
+}
+
+func TestReleaseCache(t *testing.T) {
+	data := testData(100000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 1000, WithBlockCache(4096, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10000)
+	if _, err := r.ReadAt(buf, 20000); err != nil {
+		t.Fatal(err)
+	}
+	if r.Stats().CachedBytes == 0 {
+		t.Fatal("nothing cached")
+	}
+	r.ReleaseCache()
+	if got := r.Stats().CachedBytes; got != 0 {
+		t.Fatalf("%d bytes cached after ReleaseCache", got)
+	}
+	before := atomic.LoadInt64(requests)
+	if n, err := r.ReadAt(buf, 20000); err != nil || !bytes.Equal(buf[:n], data[20000:30000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if atomic.LoadInt64(requests) == before {
+		t.Fatal("read after ReleaseCache didn't refetch")
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Put("a", []byte("1"))
+	c.Put("b", []byte("22"))
+	c.Get("a")
+	c.Put("c", []byte("333"))
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("b is the least recently used, want it evicted")
+	}
+	if _, ok := c.Get("a"); !ok || c.Bytes() != 4 {
+		t.Fatalf("a cached %v, %d bytes held", ok, c.Bytes())
+	}
+}
+
+func TestBlockCacheConflict(t *testing.T) {
+	s, _ := newServer(t, testData(100))
+	c := NewMemoryCache()
+	if _, err := NewReader(s.URL, 0, WithSharedCache(c), WithBlockCache(10, 2)); !errors.Is(err, ErrOptionConflict) {
+		t.Fatalf("got %v with the shared cache first, want ErrOptionConflict", err)
+	}
+	if _, err := NewReader(s.URL, 0, WithBlockCache(10, 2), WithSharedCache(c)); !errors.Is(err, ErrOptionConflict) {
+		t.Fatalf("got %v with the block cache first, want ErrOptionConflict", err)
+	}
+}
+
+func TestBlockCacheReadAhead(t *testing.T) {
+	data := testData(1 << 20)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithBlockCache(4096, 64), WithBlockReadAhead(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := r.Stats().Requests
+	buf := make([]byte, 1000)
+	for off := int64(0); off < 64*1024; off += 1000 {
+		if _, err := r.ReadAt(buf, off); err != nil || !bytes.Equal(buf, data[off:off+1000]) {
+			t.Fatalf("read at %d: %v", off, err)
+		}
+	}
+	// The scan ends in the 17th block, fetched 8 at a time
+	if got := r.Stats().Requests - before; got != 3 {
+		t.Fatalf("sent %d requests for the scan, want 3", got)
+	}
+	if got := r.Stats().CachedBytes; got > 64*4096 {
+		t.Fatalf("%d bytes cached, over the 64 blocks", got)
+	}
+
+	// A read spanning several missing blocks fetches them together
+	big := make([]byte, 5*4096)
+	before = r.Stats().Requests
+	if _, err := r.ReadAt(big, 800000); err != nil || !bytes.Equal(big, data[800000:800000+len(big)]) {
+		t.Fatalf("read across blocks: %v", err)
+	}
+	if got := r.Stats().Requests - before; got != 1 {
+		t.Fatalf("sent %d requests across blocks, want 1", got)
+	}
+}
@@ -0,0 +1,91 @@
+package urlreadseeker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExpiringCache is a Cache that can drop entries after a deadline. When the
+// cache given to WithSharedCache implements it, blocks from responses with
+// a max-age or Expires are stored with PutUntil so they stop being served
+// once stale. A plain Cache keeps them for as long as it likes
+type ExpiringCache interface {
+	Cache
+	PutUntil(key string, data []byte, expires time.Time)
+}
+
+// cachePolicy is what the Cache-Control and Expires headers of a response
+// allow the block cache to do with its bytes
+type cachePolicy struct {
+	noStore bool
+	// expires is when the bytes go stale, zero for no limit
+	expires time.Time
+}
+
+// parseCachePolicy reads the caching headers of a response received at now.
+// no-store, no-cache and private all keep the bytes out of the cache, and
+// s-maxage and max-age take precedence over Expires
+func parseCachePolicy(h http.Header, now time.Time) cachePolicy {
+	policy := cachePolicy{}
+	maxAge, sharedMaxAge := int64(-1), int64(-1)
+	for _, value := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			arg = strings.Trim(arg, `"`)
+			switch strings.ToLower(name) {
+			case "no-store", "no-cache", "private":
+				policy.noStore = true
+			case "max-age":
+				if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+					maxAge = n
+				}
+			case "s-maxage":
+				if n, err := strconv.ParseInt(arg, 10, 64); err == nil {
+					sharedMaxAge = n
+				}
+			}
+		}
+	}
+	if sharedMaxAge >= 0 {
+		maxAge = sharedMaxAge
+	}
+
+	switch {
+	case maxAge >= 0:
+		policy.expires = now.Add(time.Duration(maxAge) * time.Second)
+	case h.Get("Expires") != "":
+		expires, err := http.ParseTime(h.Get("Expires"))
+		if err != nil {
+			// An invalid Expires means already expired
+			expires = now
+		}
+		policy.expires = expires
+	}
+	if !policy.expires.IsZero() && !policy.expires.After(now) {
+		policy.noStore = true
+	}
+	return policy
+}
+
+// merge combines the policy of another response covering the same bytes,
+// keeping the stricter of the two
+func (p *cachePolicy) merge(other cachePolicy) {
+	p.noStore = p.noStore || other.noStore
+	if !other.expires.IsZero() && (p.expires.IsZero() || other.expires.Before(p.expires)) {
+		p.expires = other.expires
+	}
+}
+
+// cachePut stores a block as allowed by policy
+func (r *Reader) cachePut(key string, data []byte, policy cachePolicy) {
+	if policy.noStore {
+		return
+	}
+	if expiring, ok := r.cache.(ExpiringCache); ok && !policy.expires.IsZero() {
+		expiring.PutUntil(key, data, policy.expires)
+		return
+	}
+	r.cache.Put(key, data)
+}
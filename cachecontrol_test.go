@@ -0,0 +1,66 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	data := testData(100000)
+	var requests int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Header().Set("Cache-Control", req.URL.Query().Get("cc"))
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+
+	for _, tc := range []struct {
+		cacheControl string
+		cached       bool
+	}{
+		{"no-store", false},
+		{"max-age=60", true},
+	} {
+		r, err := NewReader(s.URL+"?cc="+tc.cacheControl, 0, WithSharedCache(NewMemoryCache()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1000)
+		if _, err := r.ReadAt(buf, 5000); err != nil {
+			t.Fatal(err)
+		}
+		before := atomic.LoadInt64(&requests)
+		if n, err := r.ReadAt(buf, 5000); err != nil || !bytes.Equal(buf[:n], data[5000:6000]) {
+			t.Fatalf("%s: got %d, %v", tc.cacheControl, n, err)
+		}
+		if cached := atomic.LoadInt64(&requests) == before; cached != tc.cached {
+			t.Errorf("%s: second read served from the cache %v, want %v", tc.cacheControl, cached, tc.cached)
+		}
+	}
+}
+
+func TestParseCachePolicy(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		header  http.Header
+		noStore bool
+		expires time.Time
+	}{
+		{http.Header{}, false, time.Time{}},
+		{http.Header{"Cache-Control": {"private, max-age=60"}}, true, now.Add(time.Minute)},
+		{http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, false, now.Add(10 * time.Second)},
+		{http.Header{"Cache-Control": {"max-age=0"}}, true, now},
+		{http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, false, now.Add(time.Hour)},
+		{http.Header{"Expires": {"0"}}, true, now},
+	} {
+		got := parseCachePolicy(tc.header, now)
+		if got.noStore != tc.noStore || !got.expires.Equal(tc.expires) {
+			t.Errorf("%v: got %+v", tc.header, got)
+		}
+	}
+}
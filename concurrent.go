@@ -0,0 +1,112 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// defaultChunkSize is the span each concurrent WriteTo request covers
+const defaultChunkSize = 4 * 1024 * 1024
+
+// chunkResult is a downloaded chunk waiting for its turn to be written
+type chunkResult struct {
+	body *bytes.Buffer
+	err  error
+}
+
+// chunkSize is the span of each concurrent WriteTo request, no more than
+// the range size limit
+func (r *Reader) chunkSize() int64 {
+	chunk := int64(defaultChunkSize)
+	if max := r.rangeLimit(); max > 0 && max < chunk {
+		chunk = max
+	}
+	return chunk
+}
+
+// writeConcurrent is WriteTo under WithConcurrency. Chunks download
+// concurrently and are written in order as soon as the next one is ready.
+// The ring holds the chunks queued behind the one awaited, so at most
+// concurrency are downloading or held in memory at once
+func (r *Reader) writeConcurrent(w io.Writer) (n int64, err error) {
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	start, end, chunk := r.offset, r.contentSize, r.chunkSize()
+
+	pending := make(chan chan chunkResult, r.concurrency-1)
+	go func() {
+		defer close(pending)
+		for pos := start; pos < end; pos += chunk {
+			stop := pos + chunk
+			if stop > end {
+				stop = end
+			}
+			done := make(chan chunkResult, 1)
+			select {
+			case pending <- done:
+			case <-ctx.Done():
+				return
+			}
+			go func(pos, stop int64) {
+				body := getBuffer()
+				err := r.fetchInto(ctx, body, pos, stop, nil)
+				if err == nil && int64(body.Len()) < stop-pos {
+					// The file is shorter than its size said
+					err = io.ErrUnexpectedEOF
+				}
+				done <- chunkResult{body: body, err: err}
+			}(pos, stop)
+		}
+	}()
+
+	// Keep draining after a failure so every chunk's buffer is returned
+	for done := range pending {
+		res := <-done
+		if err == nil {
+			err = res.err
+		}
+		if err == nil {
+			var written int64
+			written, err = r.copyBody(w, bytes.NewReader(res.body.Bytes()))
+			n += written
+			r.advance(written)
+		}
+		putBuffer(res.body)
+		if err != nil {
+			cancel()
+		}
+	}
+	return n, err
+}
+
+// acquireInFlight takes a WithMaxInFlight slot for a request, waiting until
+// one is free or ctx is done. release gives it back, it is safe to call
+// more than once
+func (r *Reader) acquireInFlight(ctx context.Context) (release func(), err error) {
+	if r.inFlight == nil {
+		return func() {}, nil
+	}
+	select {
+	case r.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-r.inFlight })
+	}, nil
+}
+
+// releaseBody frees its request's in-flight slot when closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,162 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowWriter is a writer that falls behind the downloads, counting what it
+// was given
+type slowWriter struct {
+	buf     bytes.Buffer
+	written int64
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	n, _ := w.buf.Write(p)
+	atomic.AddInt64(&w.written, int64(n))
+	return n, nil
+}
+
+func TestConcurrentWriteTo(t *testing.T) {
+	data := testData(1 << 20)
+	const chunk = 64 * 1024
+	w := &slowWriter{}
+	var gets, open, maxOpen, maxAhead int64
+	var mu sync.Mutex
+	raise := func(max *int64, n int64) {
+		mu.Lock()
+		if n > *max {
+			*max = n
+		}
+		mu.Unlock()
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			// Chunks fetched but not yet written are the ones held in memory
+			raise(&maxAhead, atomic.AddInt64(&gets, 1)-atomic.LoadInt64(&w.written)/chunk)
+			raise(&maxOpen, atomic.AddInt64(&open, 1))
+			defer atomic.AddInt64(&open, -1)
+			time.Sleep(2 * time.Millisecond)
+		}
+		http.ServeContent(rw, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithConcurrency(4), WithMaxRangeSize(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.WriteTo(w); err != nil || n != int64(len(data)) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !bytes.Equal(w.buf.Bytes(), data) {
+		t.Fatal("concurrent download differs from the file")
+	}
+	if got := atomic.LoadInt64(&gets); got != 16 {
+		t.Fatalf("sent %d requests, want one per 64KB chunk", got)
+	}
+	mu.Lock()
+	opened, held := maxOpen, maxAhead
+	mu.Unlock()
+	if opened > 4 {
+		t.Fatalf("%d requests open at once, want at most 4", opened)
+	}
+	if held > 4 {
+		t.Fatalf("%d chunks held at once, want at most 4", held)
+	}
+
+	if _, err := r.Seek(100001, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil || !bytes.Equal(out.Bytes(), data[100001:]) {
+		t.Fatalf("write from an unaligned offset: %v", err)
+	}
+}
+
+// openCounter is a middleware counting requests whose bodies are still
+// open, and the most it saw at once
+type openCounter struct {
+	next      http.RoundTripper
+	mu        sync.Mutex
+	open, max int
+}
+
+func (c *openCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.add(1)
+	resp, err := c.next.RoundTrip(req)
+	if err != nil {
+		c.add(-1)
+		return nil, err
+	}
+	resp.Body = &closeCounter{ReadCloser: resp.Body, counter: c}
+	return resp, nil
+}
+
+func (c *openCounter) add(n int) {
+	c.mu.Lock()
+	c.open += n
+	if c.open > c.max {
+		c.max = c.open
+	}
+	c.mu.Unlock()
+}
+
+// closeCounter takes its request off the open count once closed
+type closeCounter struct {
+	io.ReadCloser
+	counter *openCounter
+	once    sync.Once
+}
+
+func (b *closeCounter) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.counter.add(-1) })
+	return err
+}
+
+func TestMaxInFlight(t *testing.T) {
+	data := testData(100000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Long enough for the readers to pile up
+		time.Sleep(5 * time.Millisecond)
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	counter := &openCounter{}
+	mw := func(next http.RoundTripper) http.RoundTripper {
+		counter.next = next
+		return counter
+	}
+	r, err := NewReader(s.URL, 0, WithMaxInFlight(3), WithRoundTripperMiddleware(mw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(c *Reader, off int64) {
+			defer wg.Done()
+			buf := make([]byte, 1000)
+			if _, err := c.ReadAt(buf, off); err != nil || !bytes.Equal(buf, data[off:off+1000]) {
+				t.Errorf("read at %d: %v", off, err)
+			}
+		}(r.Clone(), int64(i)*4000)
+	}
+	wg.Wait()
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if counter.max > 3 {
+		t.Fatalf("%d requests open at once, want at most 3", counter.max)
+	}
+	if counter.max < 2 {
+		t.Fatal("requests never overlapped")
+	}
+}
@@ -0,0 +1,78 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+)
+
+// isDataURL reports whether url uses the data: scheme (RFC 2397)
+func isDataURL(url string) bool {
+	return len(url) >= 5 && strings.EqualFold(url[:5], "data:")
+}
+
+// loadDataURL decodes the reader's data: url into head so every read and
+// seek is served from memory
+func (r *Reader) loadDataURL() error {
+	meta, payload, ok := strings.Cut(r.url[5:], ",")
+	if !ok {
+		return fmt.Errorf("%w: data url has no ','", ErrInvalidURL)
+	}
+	data, err := urlpkg.PathUnescape(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	decoded := []byte(data)
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		decoded, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			// Padding is often left off
+			decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+	}
+
+	r.inline = true
+	r.head = decoded
+	r.contentSize = int64(len(decoded))
+	return nil
+}
+
+// readInline reads from the in-memory copy of the file
+func (r *Reader) readInline(buf []byte, offset int64) (n int, err error) {
+	if offset >= int64(len(r.head)) {
+		return 0, io.EOF
+	}
+	n = copy(buf, r.head[offset:])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// inlineRange answers a range request for [start, end) from the
+// in-memory copy of the file as if a server had sent it
+func (r *Reader) inlineRange(start, end int64) (*http.Response, error) {
+	if start >= r.contentSize {
+		return nil, io.EOF
+	}
+	if end > r.contentSize {
+		end = r.contentSize
+	}
+	header := http.Header{}
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, r.contentSize))
+	return &http.Response{
+		StatusCode:    http.StatusPartialContent,
+		Header:        header,
+		ContentLength: end - start,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.head[start:end])),
+	}, nil
+}
@@ -0,0 +1,32 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDataURL(t *testing.T) {
+	data := testData(300)
+	url := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(data)
+	r, err := NewReader(url, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d", r.Size())
+	}
+	buf := make([]byte, 50)
+	if n, err := r.ReadAt(buf, 100); err != nil || !bytes.Equal(buf[:n], data[100:150]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if _, err := r.Seek(-20, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(rest, data[280:]) {
+		t.Fatalf("got %d bytes, %v", len(rest), err)
+	}
+}
@@ -0,0 +1,94 @@
+package urlreadseeker
+
+// EstimateRequests returns how many http requests ReadAt calls for reads,
+// made in order, would send given the head, the block cache as it is now and
+// the configured block and range sizes. Blocks the earlier reads would cache
+// count as cached for the later ones. Nothing is fetched and the cache is
+// only looked at through PeekingCache, a cache without it counts as empty.
+// Retries, auth challenges and ranges the server turns out to reject are not
+// foreseen
+func (r *Reader) EstimateRequests(reads []Range) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inline || r.gzipEncoded {
+		return 0
+	}
+
+	cached := map[int64]bool{}
+	requests := 0
+	for _, rg := range reads {
+		start, end := rg.Start, rg.End
+		if head := int64(len(r.head)); start < head {
+			start = head
+		}
+		if start >= end {
+			continue
+		}
+		if r.gzip != nil {
+			if start < r.gzip.Size {
+				requests++
+			}
+			continue
+		}
+		if start >= r.contentSize && r.sizeTrusted() {
+			continue
+		}
+		if r.cache != nil && (r.sizeTrusted() || end <= r.contentSize) {
+			requests += r.estimateBlocks(start, end, cached)
+			continue
+		}
+		if end > r.contentSize && r.sizeTrusted() {
+			end = r.contentSize
+		}
+		requests += r.rangeRequests(start, end)
+	}
+	return requests
+}
+
+// estimateBlocks counts the requests readBlocks would send for [start, end),
+// marking the blocks it would fetch in cached
+func (r *Reader) estimateBlocks(start, end int64, cached map[int64]bool) int {
+	if end > r.contentSize {
+		end = r.contentSize
+	}
+	missFrom, missTo := int64(-1), int64(-1)
+	for block := start / r.blockSize * r.blockSize; block < end; block += r.blockSize {
+		if cached[block] {
+			continue
+		}
+		if r.peekBlock(block) {
+			continue
+		}
+		if missFrom < 0 {
+			missFrom = block
+		}
+		missTo = block + r.blockLen(block)
+		cached[block] = true
+	}
+	if missFrom < 0 {
+		return 0
+	}
+	for i := 0; i < r.blockReadAhead && missTo < r.contentSize && !cached[missTo]; i++ {
+		if r.peekBlock(missTo) {
+			break
+		}
+		cached[missTo] = true
+		missTo += r.blockLen(missTo)
+	}
+	return r.rangeRequests(missFrom, missTo)
+}
+
+// rangeRequests is the number of requests fetchInto splits [start, end) into
+func (r *Reader) rangeRequests(start, end int64) int {
+	if r.maxRangeSize <= 0 {
+		return 1
+	}
+	return int((end - start + r.maxRangeSize - 1) / r.maxRangeSize)
+}
+
+// peekBlock reports whether the block at start is cached, without touching
+// the cache's state
+func (r *Reader) peekBlock(start int64) bool {
+	c, ok := r.cache.(PeekingCache)
+	return ok && c.Contains(r.blockKey(start))
+}
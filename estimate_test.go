@@ -0,0 +1,99 @@
+package urlreadseeker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEstimateRequests(t *testing.T) {
+	data := testData(100000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithBlockCache(4096, 100), WithMaxRangeSize(16384))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := []Range{{0, 100}, {50, 5000}, {20000, 60000}, {30000, 30100}, {99000, 100000}}
+	want := r.EstimateRequests(reads)
+	before := atomic.LoadInt64(requests)
+	for _, rg := range reads {
+		if _, err := r.ReadAt(make([]byte, rg.End-rg.Start), rg.Start); err != nil {
+			t.Fatalf("read %v: %v", rg, err)
+		}
+	}
+	if got := atomic.LoadInt64(requests) - before; got != int64(want) {
+		t.Fatalf("estimated %d requests, sent %d", want, got)
+	}
+	if n := r.EstimateRequests(reads); n != 0 {
+		t.Fatalf("estimated %d requests once cached, want 0", n)
+	}
+}
+
+// getCounter is a Cache counting its Gets
+type getCounter struct {
+	mu     sync.Mutex
+	blocks map[string][]byte
+	gets   int
+}
+
+func (c *getCounter) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	data, ok := c.blocks[key]
+	return data, ok
+}
+
+func (c *getCounter) Put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blocks[key] = data
+}
+
+func TestEstimateRequestsLeavesCache(t *testing.T) {
+	data := testData(10000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithBlockCache(1000, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{0, 1000} {
+		if _, err := r.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := r.EstimateRequests([]Range{{0, 10}}); n != 0 {
+		t.Fatalf("estimated %d requests for a cached block, want 0", n)
+	}
+	// Block 0 is still the least recently used, so it goes first
+	if _, err := r.ReadAt(buf, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.EstimateRequests([]Range{{0, 10}}); n != 1 {
+		t.Fatalf("estimated %d requests for the evicted block, want 1", n)
+	}
+	if n := r.EstimateRequests([]Range{{1000, 1010}}); n != 0 {
+		t.Fatalf("estimated %d requests for the kept block, want 0", n)
+	}
+
+	c := &getCounter{blocks: map[string][]byte{}}
+	r, err = NewReader(s.URL, 0, WithSharedCache(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	c.mu.Lock()
+	before := c.gets
+	c.mu.Unlock()
+	if n := r.EstimateRequests([]Range{{0, 10}}); n != 1 {
+		t.Fatalf("estimated %d requests without peeking, want 1", n)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gets != before {
+		t.Fatalf("estimate made %d Gets on the cache", c.gets-before)
+	}
+}
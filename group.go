@@ -0,0 +1,36 @@
+package urlreadseeker
+
+import "net/http"
+
+// Group opens readers that share one http.Client, and so one connection
+// pool, along with the options it was created with, including any shared
+// cache. It amortizes setup when reading many files from the same host
+type Group struct {
+	client *http.Client
+	opts   []Option
+}
+
+// NewGroup builds the client described by opts once for every reader the
+// group opens
+func NewGroup(opts ...Option) (*Group, error) {
+	template := &Reader{}
+	for _, opt := range opts {
+		opt(template)
+	}
+	if template.optionErr != nil {
+		return nil, template.optionErr
+	}
+	template.client = http.DefaultClient
+	if err := template.setupClient(); err != nil {
+		return nil, err
+	}
+	return &Group{client: template.client, opts: opts}, nil
+}
+
+// Open creates a reader for url using the group's client and options
+func (g *Group) Open(url string) (*Reader, error) {
+	opts := append(g.opts[:len(g.opts):len(g.opts)], func(r *Reader) {
+		r.groupClient = g.client
+	})
+	return NewReader(url, 0, opts...)
+}
@@ -0,0 +1,47 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroupSharesTransport(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	var dials int64
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt64(&dials, 1)
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	g, err := NewGroup(WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	var first *Reader
+	for _, path := range []string{"/a", "/b", "/c"} {
+		r, err := g.Open(s.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = r
+		} else if r.client != first.client {
+			t.Fatal("readers of a group have their own clients")
+		}
+		if n, err := r.ReadAt(buf, 200); err != nil || !bytes.Equal(buf[:n], data[200:300]) {
+			t.Fatalf("%s: got %d, %v", path, n, err)
+		}
+	}
+	if got := atomic.LoadInt64(&dials); got != 1 {
+		t.Fatalf("%d connections dialed for 3 readers read in turn, want 1", got)
+	}
+}
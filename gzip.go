@@ -0,0 +1,202 @@
+package urlreadseeker
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// GzipPoint is an access point into a gzip file: decompressing from the
+// Compressed offset yields the content starting at Uncompressed
+type GzipPoint struct {
+	Compressed   int64
+	Uncompressed int64
+}
+
+// GzipIndex maps offsets in the decompressed content of a gzip file to
+// places decompression can start from. Points are gzip member boundaries,
+// so files written as many independent members (bgzip, pigz --independent,
+// concatenated gzip) give fine grained random access. A single member file
+// has no point but its start, see BuildGzipIndex
+type GzipIndex struct {
+	Points []GzipPoint
+	// Size is the total decompressed length
+	Size int64
+}
+
+// BuildGzipIndex scans the gzip stream in r and records an access point at
+// each member boundary at least span decompressed bytes past the previous one.
+// Points within a member are not supported, so a single member file longer
+// than span returns ErrGzipSingleMember rather than an index that can only
+// inflate from the start. A span of 0 or less indexes it anyway
+func BuildGzipIndex(r io.Reader, span int64) (*GzipIndex, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	z, err := gzip.NewReader(cr)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	index := &GzipIndex{}
+	var member int64
+	members := 0
+	for {
+		last := len(index.Points) - 1
+		if last < 0 || index.Size-index.Points[last].Uncompressed >= span {
+			index.Points = append(index.Points, GzipPoint{Compressed: member, Uncompressed: index.Size})
+		}
+		z.Multistream(false)
+		n, err := io.Copy(ioutil.Discard, z)
+		index.Size += n
+		if err != nil {
+			return nil, err
+		}
+		members++
+
+		member = cr.n
+		if err := z.Reset(cr); err == io.EOF {
+			if members == 1 && span > 0 && index.Size > span {
+				return nil, fmt.Errorf("%w: %d bytes, span %d", ErrGzipSingleMember, index.Size, span)
+			}
+			return index, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// point returns the last access point at or before offset
+func (g *GzipIndex) point(offset int64) GzipPoint {
+	i := sort.Search(len(g.Points), func(i int) bool {
+		return g.Points[i].Uncompressed > offset
+	})
+	if i == 0 {
+		return GzipPoint{}
+	}
+	return g.Points[i-1]
+}
+
+// readGzip reads decompressed content at offset, inflating from the nearest
+// access point
+func (r *Reader) readGzip(ctx context.Context, buf []byte, offset int64) (n int, err error) {
+	body, _, err := r.openGzip(ctx, offset, offset+int64(len(buf)))
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err = io.ReadFull(body, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// openGzip opens the decompressed content in [start, end), -1 for the rest
+// of it, inflating from the nearest access point. The headers are those of
+// the compressed range response
+func (r *Reader) openGzip(ctx context.Context, start, end int64) (io.ReadCloser, http.Header, error) {
+	if start >= r.gzip.Size {
+		return nil, nil, io.EOF
+	}
+	if end < 0 || end > r.gzip.Size {
+		end = r.gzip.Size
+	}
+	p := r.gzip.point(start)
+	resp, err := r.openRange(ctx, p.Compressed, r.contentSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	z, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	body := &gunzipBody{Reader: z, body: resp.Body}
+	if _, err := io.CopyN(ioutil.Discard, z, start-p.Uncompressed); err != nil {
+		body.Close()
+		return nil, nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(z, end-start), body}, resp.Header, nil
+}
+
+// copyGzip copies n decompressed bytes from the current offset to w, -1
+// for the rest of the content, inflating a single stream from the nearest
+// access point, and advances the offset. Like io.CopyN it returns io.EOF if
+// fewer than n bytes remain
+func (r *Reader) copyGzip(w io.Writer, n int64) (written int64, err error) {
+	end := int64(-1)
+	if n >= 0 {
+		end = r.offset + n
+	}
+	body, _, err := r.openGzip(r.ctx, r.offset, end)
+	if err == io.EOF && n < 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	written, err = r.copyBody(w, body)
+	r.advance(written)
+	if err == nil && n >= 0 && written < n {
+		err = io.EOF
+	}
+	return written, err
+}
+
+// countingReader tracks exactly how many bytes the gzip reader consumed.
+// It implements io.ByteReader so gzip doesn't add its own buffering
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// gunzipBody decompresses a gzip Content-Encoding response body, closing
+// the response along with the gzip reader
+type gunzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g *gunzipBody) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
+}
+
+// decodeBody wraps resp.Body in a gzip reader when WithTransparentGzip is
+// set and the server sent Content-Encoding: gzip
+func (r *Reader) decodeBody(resp *http.Response) (io.ReadCloser, error) {
+	if !r.transparentGzip || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return resp.Body, nil
+	}
+	z, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return &gunzipBody{Reader: z, body: resp.Body}, nil
+}
@@ -0,0 +1,200 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gzipMembers compresses data as independent gzip members of member bytes
+func gzipMembers(t *testing.T, data []byte, member int) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(data); i += member {
+		end := i + member
+		if end > len(data) {
+			end = len(data)
+		}
+		z := gzip.NewWriter(&out)
+		if _, err := z.Write(data[i:end]); err != nil {
+			t.Fatal(err)
+		}
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.Bytes()
+}
+
+func TestGzipIndex(t *testing.T) {
+	data := testData(100000)
+	compressed := gzipMembers(t, data, 10000)
+	index, err := BuildGzipIndex(bytes.NewReader(compressed), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Size != int64(len(data)) || len(index.Points) != 10 {
+		t.Fatalf("index of %d points over %d bytes", len(index.Points), index.Size)
+	}
+	s, _ := newServer(t, compressed)
+	r, err := NewReader(s.URL, 0, WithGzipIndex(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 15000)
+	if n, err := r.ReadAt(buf, 55000); err != nil || !bytes.Equal(buf[:n], data[55000:70000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+		t.Fatalf("got %q, %v at the end", rest, err)
+	}
+}
+
+func TestGzipIndexStreams(t *testing.T) {
+	data := testData(100000)
+	compressed := gzipMembers(t, data, 10000)
+	index, err := BuildGzipIndex(bytes.NewReader(compressed), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := newServer(t, compressed)
+	r, err := NewReader(s.URL, 0, WithGzipIndex(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if n, err := r.CopyN(&out, 10); err != nil || n != 10 || !bytes.Equal(out.Bytes(), data[:10]) {
+		t.Fatalf("CopyN got %q, %v", out.Bytes(), err)
+	}
+	if tail, err := r.ReadTail(5); err != nil || !bytes.Equal(tail, data[len(data)-5:]) {
+		t.Fatalf("ReadTail got %q, %v", tail, err)
+	}
+	body, _, err := r.OpenRange(context.Background(), 25000, 25010)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil || !bytes.Equal(got, data[25000:25010]) {
+		t.Fatalf("OpenRange got %q, %v", got, err)
+	}
+	stream, err := r.Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(stream)
+	stream.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Stream got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestTransparentGzip(t *testing.T) {
+	data := testData(50000)
+	encoded := gzipMembers(t, data, len(data))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(encoded))
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithTransparentGzip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(encoded)) {
+		t.Fatalf("size %d, want the compressed %d", r.Size(), len(encoded))
+	}
+	got, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, want the %d decompressed", len(got), len(data))
+	}
+	if _, err := r.ReadAt(make([]byte, 10), 100); !errors.Is(err, ErrGzipEncoded) {
+		t.Fatalf("got %v, want ErrGzipEncoded", err)
+	}
+	// None of the ranged calls may hand out compressed bytes
+	if _, err := r.CopyN(ioutil.Discard, 10); !errors.Is(err, ErrGzipEncoded) {
+		t.Fatalf("CopyN got %v, want ErrGzipEncoded", err)
+	}
+	if _, err := r.OpenFrom(context.Background(), 0); !errors.Is(err, ErrGzipEncoded) {
+		t.Fatalf("OpenFrom got %v, want ErrGzipEncoded", err)
+	}
+	if _, _, err := r.OpenRange(context.Background(), 0, 10); !errors.Is(err, ErrGzipEncoded) {
+		t.Fatalf("OpenRange got %v, want ErrGzipEncoded", err)
+	}
+	if _, err := r.ReadTail(10); !errors.Is(err, ErrGzipEncoded) {
+		t.Fatalf("ReadTail got %v, want ErrGzipEncoded", err)
+	}
+}
+
+func TestGzipIndexWriteTo(t *testing.T) {
+	data := testData(1 << 20)
+	compressed := gzipMembers(t, data, 64*1024)
+	index, err := BuildGzipIndex(bytes.NewReader(compressed), 64*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, requests := newServer(t, compressed)
+	r, err := NewReader(s.URL, 0, WithGzipIndex(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(100000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	var out bytes.Buffer
+	if n, err := r.WriteTo(&out); err != nil || n != int64(len(data)-100000) || !bytes.Equal(out.Bytes(), data[100000:]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 1 {
+		t.Fatalf("sent %d requests, want the stream opened once", got)
+	}
+	if n, err := r.WriteTo(&out); err != nil || n != 0 {
+		t.Fatalf("got %d, %v at the end", n, err)
+	}
+
+	if _, err := r.Seek(500000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	before = atomic.LoadInt64(requests)
+	if n, err := r.CopyN(&out, 200000); err != nil || n != 200000 || !bytes.Equal(out.Bytes(), data[500000:700000]) {
+		t.Fatalf("CopyN got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 1 {
+		t.Fatalf("CopyN sent %d requests, want 1", got)
+	}
+	if _, err := r.Seek(-10, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.CopyN(&out, 20); err != io.EOF || n != 10 {
+		t.Fatalf("CopyN past the end got %d, %v", n, err)
+	}
+}
+
+func TestGzipIndexSingleMember(t *testing.T) {
+	data := testData(100000)
+	compressed := gzipMembers(t, data, len(data))
+	if _, err := BuildGzipIndex(bytes.NewReader(compressed), 10000); !errors.Is(err, ErrGzipSingleMember) {
+		t.Fatalf("got %v, want ErrGzipSingleMember", err)
+	}
+	index, err := BuildGzipIndex(bytes.NewReader(compressed), 0)
+	if err != nil || len(index.Points) != 1 || index.Size != int64(len(data)) {
+		t.Fatalf("index %+v, %v with no span", index, err)
+	}
+}
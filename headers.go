@@ -0,0 +1,30 @@
+package urlreadseeker
+
+import (
+	"context"
+	"net/http"
+)
+
+// ReadAtWithHeaders is ReadAt sending the extra headers h, over the
+// reader's own, on the requests made for this read alone. The Range header
+// is always the reader's. A read served from the head or a cache makes no
+// request, so sends nothing
+func (r *Reader) ReadAtWithHeaders(buf []byte, offset int64, h http.Header) (n int, err error) {
+	return r.read(context.WithValue(r.ctx, readHeadersKey{}, h), buf, offset)
+}
+
+// readHeadersKey carries the extra headers of a ReadAtWithHeaders call down
+// to the requests it makes
+type readHeadersKey struct{}
+
+// applyReadHeaders sets the per-read headers carried by req's context,
+// leaving Range alone
+func applyReadHeaders(req *http.Request) {
+	h, _ := req.Context().Value(readHeadersKey{}).(http.Header)
+	for name, values := range h {
+		if http.CanonicalHeaderKey(name) == "Range" {
+			continue
+		}
+		req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+}
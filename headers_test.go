@@ -0,0 +1,40 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadAtWithHeaders(t *testing.T) {
+	data := testData(1000)
+	var mu sync.Mutex
+	var seen []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen = append(seen, req.Header.Get("X-Trace"))
+		mu.Unlock()
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	h := http.Header{"X-Trace": {"read-1"}, "Range": {"bytes=0-0"}}
+	if n, err := r.ReadAtWithHeaders(buf, 200, h); err != nil || !bytes.Equal(buf[:n], data[200:300]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(buf, 400); err != nil || !bytes.Equal(buf[:n], data[400:500]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 3 || seen[0] != "" || seen[1] != "read-1" || seen[2] != "" {
+		t.Fatalf("X-Trace per request %q, want it only on the second", seen)
+	}
+}
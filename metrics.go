@@ -0,0 +1,54 @@
+package urlreadseeker
+
+import (
+	"io"
+	"time"
+)
+
+// Collector receives metrics as a reader works, for bridging to Prometheus
+// or similar. Its methods are called from every goroutine using the reader,
+// clones included, so must be safe for concurrent use
+type Collector interface {
+	// IncRequests counts an http request sent, retries included
+	IncRequests()
+	// AddBytes counts response body bytes received
+	AddBytes(n int64)
+	// ObserveLatency records the time a request took to return headers
+	ObserveLatency(d time.Duration)
+	// IncCacheHit counts a block served by the block cache
+	IncCacheHit()
+	// IncCacheMiss counts a block the block cache had to fetch
+	IncCacheMiss()
+}
+
+// noopCollector is the Collector of readers without WithMetricsCollector
+type noopCollector struct{}
+
+func (noopCollector) IncRequests()                 {}
+func (noopCollector) AddBytes(int64)               {}
+func (noopCollector) ObserveLatency(time.Duration) {}
+func (noopCollector) IncCacheHit()                 {}
+func (noopCollector) IncCacheMiss()                {}
+
+// metricsBody reports the bytes read from a response body
+type metricsBody struct {
+	io.ReadCloser
+	metrics Collector
+}
+
+func (b *metricsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.metrics.AddBytes(int64(n))
+	}
+	return n, err
+}
+
+// cacheLookup reports a block cache lookup to the collector
+func (r *Reader) cacheLookup(hit bool) {
+	if hit {
+		r.metrics.IncCacheHit()
+	} else {
+		r.metrics.IncCacheMiss()
+	}
+}
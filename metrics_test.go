@@ -0,0 +1,50 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingCollector is a Collector that tallies what it is told
+type countingCollector struct {
+	mu                     sync.Mutex
+	requests, hits, misses int
+	bytes                  int64
+	latencies              int
+}
+
+func (c *countingCollector) IncRequests()                 { c.mu.Lock(); c.requests++; c.mu.Unlock() }
+func (c *countingCollector) AddBytes(n int64)             { c.mu.Lock(); c.bytes += n; c.mu.Unlock() }
+func (c *countingCollector) ObserveLatency(time.Duration) { c.mu.Lock(); c.latencies++; c.mu.Unlock() }
+func (c *countingCollector) IncCacheHit()                 { c.mu.Lock(); c.hits++; c.mu.Unlock() }
+func (c *countingCollector) IncCacheMiss()                { c.mu.Lock(); c.misses++; c.mu.Unlock() }
+
+func TestMetricsCollector(t *testing.T) {
+	data := testData(10000)
+	s, _ := newServer(t, data)
+	c := &countingCollector{}
+	r, err := NewReader(s.URL, 0, WithBlockCache(1000, 10), WithMetricsCollector(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	for i := 0; i < 2; i++ {
+		if _, err := r.ReadAt(buf, 2050); err != nil || !bytes.Equal(buf, data[2050:2150]) {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The HEAD and the block fetched by the first read
+	if c.requests != 2 || c.latencies != 2 {
+		t.Fatalf("got %d requests and %d latencies, want 2", c.requests, c.latencies)
+	}
+	if c.misses != 1 || c.hits != 1 {
+		t.Fatalf("got %d misses and %d hits, want 1 of each", c.misses, c.hits)
+	}
+	if c.bytes != 1000 {
+		t.Fatalf("got %d bytes, want the 1000 of the block", c.bytes)
+	}
+}
@@ -0,0 +1,98 @@
+package urlreadseeker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// ReadMultiRange fetches several ranges with a single multi-range request
+// and returns the bytes of each, in order. Servers that answer with a plain
+// 206 instead of multipart/byteranges are handled with one request per range
+func (r *Reader) ReadMultiRange(ranges []Range) ([][]byte, error) {
+	if len(ranges) < 2 || r.inline || r.gzip != nil {
+		return r.readRanges(ranges, make([][]byte, len(ranges)))
+	}
+
+	req, err := r.newRequest(r.ctx, ranges[0].Start, ranges[len(ranges)-1].End)
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]string, len(ranges))
+	for i, rg := range ranges {
+		specs[i] = fmt.Sprintf("%d-%d", rg.Start, rg.End-1)
+	}
+	req.Header.Set("Range", r.rangeUnit+"="+strings.Join(specs, ","))
+
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusPartialContent || mediaType != "multipart/byteranges" {
+		// Close first, the fallback requests may need its WithMaxInFlight slot
+		resp.Body.Close()
+		return r.readRanges(ranges, make([][]byte, len(ranges)))
+	}
+
+	out, err := r.readParts(resp.Body, params["boundary"], ranges)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// Anything the server left out (e.g. clipped at EOF) is fetched alone
+	return r.readRanges(ranges, out)
+}
+
+// readParts matches the parts of a multipart/byteranges response to the
+// requested ranges, leaving nil the ones it doesn't contain
+func (r *Reader) readParts(body io.Reader, boundary string, ranges []Range) ([][]byte, error) {
+	out := make([][]byte, len(ranges))
+	mr := multipart.NewReader(body, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		first, _, _, err := parseContentRange(part.Header.Get("Content-Range"), r.rangeUnit)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		// Servers may merge overlapping or adjacent ranges, so match every
+		// requested range the part contains
+		partEnd := first + int64(len(data))
+		for i, rg := range ranges {
+			if out[i] == nil && rg.Start >= first && rg.End <= partEnd {
+				out[i] = data[rg.Start-first : rg.End-first]
+			}
+		}
+	}
+	return out, nil
+}
+
+// readRanges fills the nil entries of out with one request per range
+func (r *Reader) readRanges(ranges []Range, out [][]byte) ([][]byte, error) {
+	for i, rg := range ranges {
+		if out[i] != nil {
+			continue
+		}
+		buf := make([]byte, rg.End-rg.Start)
+		n, err := r.ReadAt(buf, rg.Start)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		out[i] = buf[:n]
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadMultiRange(t *testing.T) {
+	data := testData(10000)
+	// http.ServeContent answers several ranges with multipart/byteranges
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := []Range{{10, 20}, {5000, 5100}, {9990, 10000}}
+	before := atomic.LoadInt64(requests)
+	parts, err := r.ReadMultiRange(ranges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, rg := range ranges {
+		if !bytes.Equal(parts[i], data[rg.Start:rg.End]) {
+			t.Errorf("range %d got %d wrong bytes", i, len(parts[i]))
+		}
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 1 {
+		t.Fatalf("%d requests, want one multipart request", got)
+	}
+}
+
+func TestReadMultiRangeFallback(t *testing.T) {
+	data := testData(10000)
+	// Only ever answer the first range asked for
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if first, _, ok := strings.Cut(req.Header.Get("Range"), ","); ok {
+			req.Header.Set("Range", first)
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges := []Range{{10, 20}, {5000, 5100}}
+	parts, err := r.ReadMultiRange(ranges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, rg := range ranges {
+		if !bytes.Equal(parts[i], data[rg.Start:rg.End]) {
+			t.Errorf("range %d got %d wrong bytes", i, len(parts[i]))
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package urlreadseeker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Option configures optional Reader behaviour
+type Option func(*Reader)
+
+// WithMaxRequests caps the total number of http requests the reader and its
+// clones will issue. Once n requests have been made, reads return
+// ErrRequestBudgetExceeded. n <= 0 means no limit
+func WithMaxRequests(n int) Option {
+	return func(r *Reader) {
+		r.maxRequests = n
+		r.budgetUsed = new(int64)
+	}
+}
+
+// WithSharedCache routes reads through c, fetching and storing whole blocks
+// keyed by url and block offset. Readers given the same Cache share data,
+// NewMemoryCache provides an in-memory implementation
+func WithSharedCache(c Cache) Option {
+	return func(r *Reader) {
+		r.cache = c
+		r.sharedCache = c != nil
+	}
+}
+
+// WithStaleSize treats the size learned at construction as a hint only, for
+// files that may grow while being read. Reads past it are sent to the server
+// and EOF is decided by a 416 or empty response
+func WithStaleSize() Option {
+	return func(r *Reader) {
+		r.sizeStale = true
+	}
+}
+
+// WithAuthChallengeHandler answers 401 responses. The handler receives the
+// WWW-Authenticate challenge (e.g. `Bearer realm="...",service="..."`) and
+// returns the Authorization header to use. The failed request is retried
+// once and the header is kept for every later request
+func WithAuthChallengeHandler(handler func(challenge string) (authHeader string, err error)) Option {
+	return func(r *Reader) {
+		r.authHandler = handler
+	}
+}
+
+// WithTransport sends all requests through rt
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Reader) {
+		r.transport = rt
+	}
+}
+
+// WithClientCert presents cert to servers requiring mutual TLS. It can be
+// given several times and conflicts with WithTransport
+func WithClientCert(cert tls.Certificate) Option {
+	return func(r *Reader) {
+		c := r.tlsSettings()
+		c.Certificates = append(c.Certificates, cert)
+	}
+}
+
+// WithRootCAs verifies servers against pool instead of the system roots.
+// It conflicts with WithTransport
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(r *Reader) {
+		r.tlsSettings().RootCAs = pool
+	}
+}
+
+// WithPinRedirect sends every request after the first successful one
+// straight to the url it was redirected to, see ResolvedURL
+func WithPinRedirect() Option {
+	return func(r *Reader) {
+		r.pinRedirect = true
+	}
+}
+
+// WithEndpointResolver rewrites the url of every range request. resolve gets
+// the url that would be used and the range [start, end) being fetched, end
+// being -1 for open-ended ranges and start being -n for the last n bytes,
+// which lets sharded or mirrored backends route by offset
+func WithEndpointResolver(resolve func(url string, start, end int64) (string, error)) Option {
+	return func(r *Reader) {
+		r.resolver = resolve
+	}
+}
+
+// WithAdoptFullBody keeps the body when a server answers a range request
+// with 200 and the whole file, serving all further reads from memory. A body
+// whose length isn't the known size fails with ErrInconsistentSize. Without
+// it such responses fail with ErrRangeNotSupported
+func WithAdoptFullBody() Option {
+	return func(r *Reader) {
+		r.adoptFull = true
+	}
+}
+
+// WithGzipIndex treats the remote file as gzip and makes reads, seeks,
+// streams and tails address its decompressed content, see BuildGzipIndex
+func WithGzipIndex(index *GzipIndex) Option {
+	return func(r *Reader) {
+		r.gzip = index
+	}
+}
+
+// WithMaxRangeSize splits reads larger than n bytes into several range
+// requests of at most n bytes each
+func WithMaxRangeSize(n int64) Option {
+	return func(r *Reader) {
+		r.maxRangeSize = n
+	}
+}
+
+// WithNoProxy connects directly, ignoring HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY which are honored by default. It conflicts with WithTransport
+func WithNoProxy() Option {
+	return func(r *Reader) {
+		r.noProxy = true
+	}
+}
+
+// WithAccept sets the Accept header on the size probe and every range
+// request so the server sizes and serves one representation
+func WithAccept(accept string) Option {
+	return func(r *Reader) {
+		r.accept = accept
+	}
+}
+
+// WithWarmConnection issues the first range GET right after the HEAD, while
+// its keep-alive connection is still pooled, so the first real read doesn't
+// pay for a new TCP and TLS handshake if the caller idles past the pool's
+// idle timeout. The bytes are kept as the head, see NewReader's prefetch
+func WithWarmConnection() Option {
+	return func(r *Reader) {
+		r.warmConnection = true
+	}
+}
+
+// WithRangeUnit formats the Range header as unit=start-end for servers that
+// advertise a unit other than bytes in Accept-Ranges. Responses must use the
+// same unit in Content-Range
+func WithRangeUnit(unit string) Option {
+	return func(r *Reader) {
+		r.rangeUnit = unit
+	}
+}
+
+// WithMaxIdleConns keeps up to n idle connections to the server pooled, the
+// default transport only keeps 2 per host which throttles readers pulling
+// many small ranges. It conflicts with WithTransport
+func WithMaxIdleConns(n int) Option {
+	return func(r *Reader) {
+		r.maxIdleConns = n
+	}
+}
+
+// WithMaxConnsPerHost limits the connections open to the server at once.
+// It conflicts with WithTransport
+func WithMaxConnsPerHost(n int) Option {
+	return func(r *Reader) {
+		r.maxConnsPerHost = n
+	}
+}
+
+// WithRangeRejectStatus sets the statuses a server answers ranges that are
+// too large with, 413 by default. On such a status the range is halved and
+// retried, and the smaller size is kept as the limit for later reads
+func WithRangeRejectStatus(codes ...int) Option {
+	return func(r *Reader) {
+		r.rangeRejectStatus = codes
+	}
+}
+
+// WithRoundTripperMiddleware wraps the transport, default or custom, with
+// each middleware in turn so the last one given sees requests first. It can
+// be given several times and composes with every other transport option
+func WithRoundTripperMiddleware(mw ...func(http.RoundTripper) http.RoundTripper) Option {
+	return func(r *Reader) {
+		r.middleware = append(r.middleware, mw...)
+	}
+}
+
+// WithURLProvider supplies the url and when it expires, for pre-signed urls.
+// It is called at construction, replacing the url given to NewReader, and
+// again before any request once the url is within the skew of expiring, see
+// WithURLExpirySkew. A zero expiry never expires
+func WithURLProvider(provider func(ctx context.Context) (string, time.Time, error)) Option {
+	return func(r *Reader) {
+		r.urlProvider = provider
+	}
+}
+
+// WithURLExpirySkew sets how long before expiry a provided url is refreshed,
+// 30 seconds by default
+func WithURLExpirySkew(d time.Duration) Option {
+	return func(r *Reader) {
+		r.urlSkew = d
+	}
+}
+
+// WithVerifyComplete makes Close return ErrIncompleteRead unless the bytes
+// read sequentially (Read, WriteTo, CopyN) add up to exactly the file size.
+// It only makes sense when the whole file is meant to be read once in order
+func WithVerifyComplete() Option {
+	return func(r *Reader) {
+		r.verifyComplete = true
+	}
+}
+
+// WithSizeProbeMethods sets which methods learn the file size and in what
+// order, "HEAD" reading Content-Length and "GET" a one byte range. The
+// default is HEAD then GET, a later method is only tried when the previous
+// one got a bad status or no usable size
+func WithSizeProbeMethods(methods []string) Option {
+	return func(r *Reader) {
+		r.probeMethods = methods
+	}
+}
+
+// WithRequestIDHeader sets header name to a fresh value from gen on every
+// request, including retries, so they can be matched with server logs
+func WithRequestIDHeader(name string, gen func() string) Option {
+	return func(r *Reader) {
+		r.requestIDHeader = name
+		r.requestIDGen = gen
+	}
+}
+
+// WithAllowUnknownSize creates the reader even when the server reports no
+// size. Its size is then -1: reads go to the server, which decides where
+// the file ends, and ReadTail or later reads fill the size in
+func WithAllowUnknownSize() Option {
+	return func(r *Reader) {
+		r.allowUnknownSize = true
+	}
+}
+
+// WithRetries retries requests failing with a network error, 429 or 5xx up
+// to n times, waiting backoff before the first retry and doubling the wait
+// each time after
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(r *Reader) {
+		r.retries = n
+		r.backoff = backoff
+	}
+}
+
+// WithMaxBackoff caps the wait before any one retry, 30 seconds by default.
+// d <= 0 removes the cap
+func WithMaxBackoff(d time.Duration) Option {
+	return func(r *Reader) {
+		r.maxBackoff = d
+	}
+}
+
+// WithRetryBudget limits the retries a reader makes over its whole life to
+// total, after which failures are returned straight away
+func WithRetryBudget(total int) Option {
+	return func(r *Reader) {
+		r.retryBudget = total
+	}
+}
+
+// WithOnChunk calls fn with the offset and bytes of every range fetched into
+// memory, before they are cached or copied out. data is only valid during
+// the call and must be neither modified nor retained. Bodies handed over
+// live, by Stream, OpenRange, OpenFrom and WriteTo, aren't buffered and
+// aren't seen by fn
+func WithOnChunk(fn func(start int64, data []byte)) Option {
+	return func(r *Reader) {
+		r.onChunk = fn
+	}
+}
+
+// WithLenientContentRange accepts 206 responses with a missing or unparsable
+// Content-Range, trusting the body to start where it was asked to. Only for
+// servers known to get the body right
+func WithLenientContentRange() Option {
+	return func(r *Reader) {
+		r.lenientContentRange = true
+	}
+}
+
+// WithMaxReadAhead caps the buffer of Buffered at n bytes, 8MiB by default.
+// It grows to the cap over a sequential scan
+func WithMaxReadAhead(n int) Option {
+	return func(r *Reader) {
+		r.maxReadAhead = n
+	}
+}
+
+// WithMetricsCollector reports requests, bytes received, latency and block
+// cache hits and misses to c as they happen. nil collects nothing
+func WithMetricsCollector(c Collector) Option {
+	return func(r *Reader) {
+		if c == nil {
+			c = noopCollector{}
+		}
+		r.metrics = c
+	}
+}
+
+// WithTransparentGzip decompresses responses sent with Content-Encoding:
+// gzip when the file is read whole, by Stream, WriteTo or ReadAll. When the
+// size probe finds the source is gzip encoded, Size is the compressed size
+// and Read, ReadAt, Seek, CopyN, OpenFrom, OpenRange and ReadTail return
+// ErrGzipEncoded, as ranges of it can't be decompressed. For random access
+// into gzip files see WithGzipIndex
+func WithTransparentGzip() Option {
+	return func(r *Reader) {
+		r.transparentGzip = true
+	}
+}
+
+// WithCopyBufferSize makes WriteTo, CopyN and io.Copy from a Stream copy
+// through a buffer of n bytes, bounding both their memory and the size of
+// each write. n must be positive
+func WithCopyBufferSize(n int) Option {
+	return func(r *Reader) {
+		if n <= 0 && r.optionErr == nil {
+			r.optionErr = fmt.Errorf("%w: copy buffer size %d", ErrInvalidOption, n)
+		}
+		r.copyBufferSize = n
+	}
+}
+
+// WithSeekValidation makes Seek return ErrSeekOutOfBounds, leaving the
+// offset alone, rather than move past the end of a file of known size
+func WithSeekValidation() Option {
+	return func(r *Reader) {
+		r.seekValidation = true
+	}
+}
+
+// WithRangeResponseValidator replaces the status and Content-Range checks
+// on range responses for servers that answer ranges in their own way. fn
+// gets each response to a request for [reqStart, reqEnd), reqEnd being -1
+// when open-ended, and returns the file offset the body starts at: reqStart
+// for a proper 206, 0 for a full body. Bytes before reqStart are skipped and
+// the body is cut off at reqEnd. An error fails the read, fn must not close
+// the body
+func WithRangeResponseValidator(fn func(resp *http.Response, reqStart, reqEnd int64) (bodyStart int64, err error)) Option {
+	return func(r *Reader) {
+		r.rangeValidator = fn
+	}
+}
+
+// WithSizeTTL makes the first read after d has passed since the size was
+// learned call RefreshSize first, so a long-lived reader over a file that
+// changes picks up its new size and content
+func WithSizeTTL(d time.Duration) Option {
+	return func(r *Reader) {
+		r.sizeTTL = d
+	}
+}
+
+// WithSmallFileThreshold downloads files of at most n bytes whole with a
+// single GET when the reader is created. Every read, seek and stream is
+// then served from memory. Larger files use range requests as usual, as do
+// files whose size is unknown or stale under WithStaleSize
+func WithSmallFileThreshold(n int64) Option {
+	return func(r *Reader) {
+		r.smallFileThreshold = n
+	}
+}
+
+// WithPrefetchRequired makes NewReader fail when the prefetch of the head
+// fails. Without it the reader is returned with no head, reads go to the
+// server and the failure is kept for PrefetchError
+func WithPrefetchRequired() Option {
+	return func(r *Reader) {
+		r.prefetchRequired = true
+	}
+}
+
+// WithConcurrency makes WriteTo download the file in 4MiB chunks, or the
+// WithMaxRangeSize if smaller, with up to n requests at once. Chunks are
+// written in order as they complete, holding at most n in memory
+func WithConcurrency(n int) Option {
+	return func(r *Reader) {
+		r.concurrency = n
+	}
+}
+
+// WithMaxInFlight bounds the requests the reader and its clones have open
+// at once to n, across reads, WarmCache and concurrent WriteTo. A request
+// holds its slot until its body is closed, others wait for one, giving up
+// if their context is done
+func WithMaxInFlight(n int) Option {
+	return func(r *Reader) {
+		if n <= 0 {
+			if r.optionErr == nil {
+				r.optionErr = fmt.Errorf("%w: max in flight %d", ErrInvalidOption, n)
+			}
+			return
+		}
+		r.inFlight = make(chan struct{}, n)
+	}
+}
+
+// WithBlockCache caches reads in a private LRUCache of up to maxBlocks
+// blocks of blockSize bytes. Reads are aligned to blocks, so nearby and
+// repeated reads are served from memory, and a read spanning several
+// missing blocks fetches them with one request. It can't be combined with
+// WithSharedCache
+func WithBlockCache(blockSize int64, maxBlocks int) Option {
+	return func(r *Reader) {
+		if (blockSize <= 0 || maxBlocks <= 0) && r.optionErr == nil {
+			r.optionErr = fmt.Errorf("%w: block cache of %d blocks of %d bytes", ErrInvalidOption, maxBlocks, blockSize)
+			return
+		}
+		r.blockSize = blockSize
+		r.lruBlocks = maxBlocks
+		r.privateCache = NewLRUCache(maxBlocks)
+		r.cache = r.privateCache
+	}
+}
+
+// WithBlockReadAhead makes a read that misses the block cache fetch up to n
+// further blocks along with the missing ones, so a forward scan of small
+// reads needs one request per n+1 blocks
+func WithBlockReadAhead(n int) Option {
+	return func(r *Reader) {
+		r.blockReadAhead = n
+	}
+}
+
+// WithClient sends requests with c instead of http.DefaultClient, for its
+// authentication, cookies, timeouts or redirect policy. Transport settings
+// conflict with it, middleware wraps a copy of it
+func WithClient(c *http.Client) Option {
+	return func(r *Reader) {
+		r.userClient = c
+	}
+}
+
+// WithHeader adds a header sent with every request, such as Authorization
+// or User-Agent. It can be given several times. Range is the reader's own
+// and is never set this way
+func WithHeader(key, value string) Option {
+	return func(r *Reader) {
+		if r.headers == nil {
+			r.headers = http.Header{}
+		}
+		r.headers.Add(key, value)
+	}
+}
+
+// WithPrefetch sets the head prefetched by NewReaderWithOptions, or by the
+// other constructors when their prefetch is 0
+func WithPrefetch(n int) Option {
+	return func(r *Reader) {
+		r.prefetch = n
+	}
+}
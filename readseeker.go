@@ -0,0 +1,148 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NewReaderFromReadSeeker serves rs through the Reader API, so code written
+// against this package works the same over a local source. Requests are
+// answered in-process by seeking rs, which the reader then owns: it must not
+// be used elsewhere while the reader is. A negative size is found by seeking
+// to the end. Caching, stats, clones and the other options behave as they
+// do over http, options about the network have nothing to act on
+func NewReaderFromReadSeeker(rs io.ReadSeeker, size int64, opts ...Option) (*Reader, error) {
+	if size < 0 {
+		end, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		size = end
+	}
+	client := &http.Client{Transport: &readSeekerTransport{rs: rs, size: size}}
+	key := fmt.Sprintf("readseeker:%p", rs)
+	opts = append(opts[:len(opts):len(opts)], func(r *Reader) {
+		r.groupClient = client
+		r.key = key
+	})
+	return NewReader("http://readseeker/", 0, opts...)
+}
+
+// readSeekerTransport answers HEAD and range GET requests from rs
+type readSeekerTransport struct {
+	mu   sync.Mutex
+	rs   io.ReadSeeker
+	size int64
+}
+
+func (t *readSeekerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Request:    req,
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+	}
+	resp.Header.Set("Accept-Ranges", "bytes")
+	if req.Method == http.MethodHead {
+		resp.ContentLength = t.size
+		resp.Header.Set("Content-Length", strconv.FormatInt(t.size, 10))
+		return resp, nil
+	}
+
+	start, end := int64(0), t.size
+	if spec := req.Header.Get("Range"); spec != "" {
+		unit, first, last, ok := parseRangeSpec(spec, t.size)
+		if !ok {
+			resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+			resp.Header.Set("Content-Range", fmt.Sprintf("%s */%d", unit, t.size))
+			return resp, nil
+		}
+		start, end = first, last+1
+		resp.StatusCode = http.StatusPartialContent
+		resp.Header.Set("Content-Range", fmt.Sprintf("%s %d-%d/%d", unit, first, last, t.size))
+	}
+	resp.ContentLength = end - start
+	resp.Header.Set("Content-Length", strconv.FormatInt(end-start, 10))
+	resp.Body = &readSeekerBody{t: t, pos: start, end: end}
+	return resp, nil
+}
+
+// parseRangeSpec parses a single range header value against a file of size
+// bytes into the inclusive [first, last] it asks for. ok is false when the
+// range is unsatisfiable or not one this transport serves
+func parseRangeSpec(spec string, size int64) (unit string, first, last int64, ok bool) {
+	unit, ranges, found := strings.Cut(spec, "=")
+	if !found || strings.Contains(ranges, ",") {
+		return unit, 0, 0, false
+	}
+	from, to, found := strings.Cut(strings.TrimSpace(ranges), "-")
+	if !found {
+		return unit, 0, 0, false
+	}
+	if from == "" {
+		// Suffix range, the last n bytes
+		n, err := strconv.ParseInt(to, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return unit, 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return unit, size - n, size - 1, true
+	}
+	first, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || first >= size {
+		return unit, 0, 0, false
+	}
+	last = size - 1
+	if to != "" {
+		last, err = strconv.ParseInt(to, 10, 64)
+		if err != nil || last < first {
+			return unit, 0, 0, false
+		}
+		if last >= size {
+			last = size - 1
+		}
+	}
+	return unit, first, last, true
+}
+
+// readSeekerBody reads [pos, end) of the transport's source, seeking before
+// every read so concurrent bodies don't disturb each other
+type readSeekerBody struct {
+	t   *readSeekerTransport
+	pos int64
+	end int64
+}
+
+func (b *readSeekerBody) Read(buf []byte) (int, error) {
+	if b.pos >= b.end {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > b.end-b.pos {
+		buf = buf[:b.end-b.pos]
+	}
+	b.t.mu.Lock()
+	defer b.t.mu.Unlock()
+	if _, err := b.t.rs.Seek(b.pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := b.t.rs.Read(buf)
+	b.pos += int64(n)
+	if err == io.EOF && b.pos < b.end {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (b *readSeekerBody) Close() error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewReaderFromReadSeeker(t *testing.T) {
+	data := testData(10000)
+	r, err := NewReaderFromReadSeeker(bytes.NewReader(data), -1, WithBlockCache(1024, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d", r.Size())
+	}
+	buf := make([]byte, 3000)
+	if n, err := r.ReadAt(buf, 2500); err != nil || !bytes.Equal(buf[:n], data[2500:5500]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if pos, err := r.Seek(-100, io.SeekEnd); err != nil || pos != 9900 {
+		t.Fatalf("seek got %d, %v", pos, err)
+	}
+	if rest, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(rest, data[9900:]) {
+		t.Fatalf("got %d bytes, %v", len(rest), err)
+	}
+	if tail, err := r.ReadTail(10); err != nil || !bytes.Equal(tail, data[len(data)-10:]) {
+		t.Fatalf("tail got %d bytes, %v", len(tail), err)
+	}
+	section, err := ioutil.ReadAll(r.Section(100, 50))
+	if err != nil || !bytes.Equal(section, data[100:150]) {
+		t.Fatalf("section got %d bytes, %v", len(section), err)
+	}
+}
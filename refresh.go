@@ -0,0 +1,171 @@
+package urlreadseeker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RefreshSize revalidates the file with a conditional size probe, sending
+// If-None-Match when the server gave an ETag and If-Modified-Since with its
+// Last-Modified date otherwise. The probe methods are tried in the same
+// order and fall through the same way as when the reader was created, see
+// WithSizeProbeMethods. A 304 means nothing changed. Otherwise the size and
+// validators are updated and, if the file changed, the head and any private
+// block cache are dropped. Blocks of the old version in a shared cache are
+// left for the readers still on it, this one stops using them
+func (r *Reader) RefreshSize() (changed bool, err error) {
+	r.mu.Lock()
+	r.sizeChecked = time.Now()
+	r.mu.Unlock()
+	if r.inline && isDataURL(r.url) {
+		return false, nil
+	}
+	if len(r.probeMethods) == 0 {
+		return false, errors.New("no size probe methods")
+	}
+	r.mu.Lock()
+	etag, lastModified, size := r.etag, r.lastModified, r.contentSize
+	r.mu.Unlock()
+
+	var header http.Header
+	var newSize int64
+	for _, method := range r.probeMethods {
+		header, newSize, err = r.revalidate(method, etag, lastModified)
+		err = connectError(method, err)
+		if err == nil || !r.probeFallsThrough(r.ctx, method, err) {
+			break
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if header == nil {
+		// 304 Not Modified
+		return false, nil
+	}
+
+	newETag := header.Get("ETag")
+	newLastModified := header.Get("Last-Modified")
+	changed = newSize != size || newETag != etag
+	if etag == "" && lastModified != "" && newerDate(newLastModified, lastModified) {
+		changed = true
+	}
+
+	r.mu.Lock()
+	r.contentSize = newSize
+	r.etag = newETag
+	r.lastModified = newLastModified
+	if changed {
+		r.keyVersion = fileVersion(newETag, newLastModified, newSize)
+	}
+	r.mu.Unlock()
+	if changed {
+		r.ReleaseCache()
+	}
+	return changed, nil
+}
+
+// revalidate sends one conditional size probe, a HEAD or a one byte GET,
+// and returns the response headers and the size they give. The headers are
+// nil when the server answered 304
+func (r *Reader) revalidate(method, etag, lastModified string) (http.Header, int64, error) {
+	var req *http.Request
+	var err error
+	switch method {
+	case http.MethodHead:
+		var url string
+		if url, err = r.requestURL(r.ctx); err == nil {
+			req, err = http.NewRequestWithContext(r.ctx, http.MethodHead, url, nil)
+		}
+	case http.MethodGet:
+		req, err = r.newRequest(r.ctx, 0, 1)
+	default:
+		return nil, 0, fmt.Errorf("unsupported size probe method %q", method)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case etag != "":
+		req.Header.Set("If-None-Match", etag)
+	case lastModified != "":
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, 0, nil
+	case method == http.MethodGet && resp.StatusCode == http.StatusPartialContent:
+		_, _, total, err := parseContentRange(resp.Header.Get("Content-Range"), r.rangeUnit)
+		if err != nil || total < 0 {
+			return nil, 0, ErrNoContentLength
+		}
+		return resp.Header, total, nil
+	case method == http.MethodGet && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// Even the first byte is out of range, the file is empty
+		return resp.Header, 0, nil
+	case resp.StatusCode/100 != 2:
+		return nil, 0, newStatusError(resp)
+	}
+	// A HEAD, or a GET answered in full
+	newSize, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil || newSize < 0 {
+		return nil, 0, ErrNoContentLength
+	}
+	return resp.Header, newSize, nil
+}
+
+// fileVersion names a version of the file in block cache keys
+func fileVersion(etag, lastModified string, size int64) string {
+	if etag != "" {
+		return etag
+	}
+	return fmt.Sprintf("%s/%d", lastModified, size)
+}
+
+// checkSizeTTL refreshes the size when WithSizeTTL has elapsed since it was
+// last learned. A failed refresh keeps the old size and is recorded for
+// SizeRefreshError
+func (r *Reader) checkSizeTTL() {
+	r.mu.Lock()
+	due := r.sizeTTL > 0 && time.Since(r.sizeChecked) >= r.sizeTTL
+	r.mu.Unlock()
+	if !due {
+		return
+	}
+	_, err := r.RefreshSize()
+	r.mu.Lock()
+	r.refreshErr = err
+	r.mu.Unlock()
+}
+
+// SizeRefreshError returns why the last refresh made for WithSizeTTL failed,
+// nil if it succeeded or none was due yet. Reads carry on with the old size
+// and the next refresh is tried once the TTL elapses again
+func (r *Reader) SizeRefreshError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refreshErr
+}
+
+// newerDate reports whether the http date a is after b. Unparsable dates
+// that differ count as newer
+func newerDate(a, b string) bool {
+	if a == b {
+		return false
+	}
+	ta, errA := http.ParseTime(a)
+	tb, errB := http.ParseTime(b)
+	if errA != nil || errB != nil {
+		return true
+	}
+	return ta.After(tb)
+}
@@ -0,0 +1,169 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshSizeIfModifiedSince(t *testing.T) {
+	var mu sync.Mutex
+	data, modified := testData(1000), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var conditional []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		body, mod := data, modified
+		if req.Method == http.MethodHead {
+			conditional = append(conditional, req.Header.Get("If-Modified-Since"))
+		}
+		mu.Unlock()
+		http.ServeContent(w, req, "file", mod, bytes.NewReader(body))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := r.RefreshSize()
+	if err != nil || changed {
+		t.Fatalf("unchanged file: changed %v, %v", changed, err)
+	}
+	mu.Lock()
+	data, modified = testData(2000), modified.Add(time.Hour)
+	mu.Unlock()
+	changed, err = r.RefreshSize()
+	if err != nil || !changed || r.Size() != 2000 {
+		t.Fatalf("changed file: changed %v, size %d, %v", changed, r.Size(), err)
+	}
+
+	// Rewritten in place, only the newer Last-Modified gives it away
+	mu.Lock()
+	data, modified = bytes.Repeat([]byte{'x'}, 2000), modified.Add(time.Hour)
+	mu.Unlock()
+	changed, err = r.RefreshSize()
+	if err != nil || !changed || r.Size() != 2000 {
+		t.Fatalf("same size, newer file: changed %v, size %d, %v", changed, r.Size(), err)
+	}
+	if changed, err = r.RefreshSize(); err != nil || changed {
+		t.Fatalf("unchanged since: changed %v, %v", changed, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []string{
+		"",
+		first.Format(http.TimeFormat),
+		first.Format(http.TimeFormat),
+		first.Add(time.Hour).Format(http.TimeFormat),
+		first.Add(2 * time.Hour).Format(http.TimeFormat),
+	}
+	if fmt.Sprint(conditional) != fmt.Sprint(want) {
+		t.Fatalf("If-Modified-Since sent %q, want %q", conditional, want)
+	}
+}
+
+func TestSizeTTL(t *testing.T) {
+	data := testData(200)
+	g := &growingServer{data: data[:100]}
+	var failProbe int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		probe := req.Method == http.MethodHead || req.Header.Get("Range") == "bytes=0-0"
+		if probe && atomic.LoadInt32(&failProbe) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		g.ServeHTTP(w, req)
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithSizeTTL(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 50)
+	if _, err := r.ReadAt(buf, 150); err != io.EOF {
+		t.Fatalf("got %v past the old end, want io.EOF", err)
+	}
+
+	g.grow(data)
+	time.Sleep(60 * time.Millisecond)
+	if n, err := r.ReadAt(buf, 150); err != nil || n != 50 || !bytes.Equal(buf, data[150:]) {
+		t.Fatalf("got %d, %v once the TTL expired", n, err)
+	}
+	if r.Size() != 200 || r.SizeRefreshError() != nil {
+		t.Fatalf("size %d, refresh error %v", r.Size(), r.SizeRefreshError())
+	}
+
+	atomic.StoreInt32(&failProbe, 1)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, data[:50]) {
+		t.Fatalf("read with a failing refresh: %v", err)
+	}
+	var status *StatusError
+	if err := r.SizeRefreshError(); !errors.As(err, &status) {
+		t.Fatalf("refresh error %v, want a *StatusError", err)
+	}
+
+	atomic.StoreInt32(&failProbe, 0)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SizeRefreshError(); err != nil {
+		t.Fatalf("refresh error %v after a good refresh, want nil", err)
+	}
+}
+
+func TestRefreshSizeGetOnly(t *testing.T) {
+	data := testData(200)
+	g := &growingServer{data: data[:100]}
+	var heads int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			// Pre-signed for GET only
+			atomic.AddInt64(&heads, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		g.ServeHTTP(w, req)
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithSizeTTL(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := r.RefreshSize(); err != nil || changed {
+		t.Fatalf("unchanged file: changed %v, %v", changed, err)
+	}
+
+	g.grow(data)
+	time.Sleep(60 * time.Millisecond)
+	buf := make([]byte, 50)
+	if n, err := r.ReadAt(buf, 150); err != nil || n != 50 || !bytes.Equal(buf, data[150:]) {
+		t.Fatalf("got %d, %v once the TTL expired", n, err)
+	}
+	if r.Size() != 200 || r.SizeRefreshError() != nil {
+		t.Fatalf("size %d, refresh error %v", r.Size(), r.SizeRefreshError())
+	}
+
+	// Only the GET probe is tried when told so
+	before := atomic.LoadInt64(&heads)
+	r, err = NewReader(s.URL, 0, WithSizeProbeMethods([]string{http.MethodGet}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RefreshSize(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&heads); n != before {
+		t.Fatalf("sent %d HEADs, want none", n-before)
+	}
+}
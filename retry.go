@@ -0,0 +1,112 @@
+package urlreadseeker
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultMaxBackoff caps the wait before any single retry
+const defaultMaxBackoff = 30 * time.Second
+
+// sendRetry sends req, retrying network errors, 429s and 5xx statuses with
+// exponential backoff as configured by WithRetries. A 429 or 503 with a
+// Retry-After waits as long as it asks instead. When the retries or the
+// reader's retry budget run out the last response or error is returned
+func (r *Reader) sendRetry(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := r.send(req)
+		if !retryable(resp, err) || req.Context().Err() != nil || attempt >= r.retries || !r.takeRetry() {
+			return resp, err
+		}
+		wait := r.backoffFor(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp.Header); ok && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+				// The server said how long, but WithMaxBackoff still bounds it
+				wait = d
+				if r.maxBackoff > 0 && wait > r.maxBackoff {
+					wait = r.maxBackoff
+				}
+			}
+			resp.Body.Close()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		case <-t.C:
+		}
+	}
+}
+
+// retryable reports whether a request failed in a way worth repeating
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return err != ErrRequestBudgetExceeded
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+}
+
+// retryAfter parses a Retry-After header, in seconds or an http date
+func retryAfter(h http.Header) (time.Duration, bool) {
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(date); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// takeRetry spends one retry from the reader's budget
+func (r *Reader) takeRetry() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.retryBudget > 0 && r.retried >= r.retryBudget {
+		return false
+	}
+	r.retried++
+	return true
+}
+
+// backoffFor is the wait before retry number attempt+1, doubling each time
+// up to maxBackoff
+func (r *Reader) backoffFor(attempt int) time.Duration {
+	d := r.backoff
+	for i := 0; i < attempt && (r.maxBackoff <= 0 || d < r.maxBackoff); i++ {
+		d *= 2
+	}
+	if r.maxBackoff > 0 && d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+	return d
+}
+
+// staleConnection reports whether err looks like a reused connection the
+// server or a proxy had already dropped: an EOF or reset sending the
+// request or cut short reading the body. The io.EOF openRange returns for
+// a range past the end of the file is not one
+func staleConnection(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	} else if err == io.EOF {
+		return false
+	}
+	var opErr *net.OpError
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &opErr)
+}
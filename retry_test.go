@@ -0,0 +1,141 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffCeiling(t *testing.T) {
+	r := &Reader{}
+	r.backoff = 10 * time.Millisecond
+	r.maxBackoff = 100 * time.Millisecond
+	want := []time.Duration{10, 20, 40, 80, 100, 100}
+	for attempt, ms := range want {
+		if got := r.backoffFor(attempt); got != ms*time.Millisecond {
+			t.Errorf("attempt %d waits %v, want %v", attempt, got, ms*time.Millisecond)
+		}
+	}
+	if got := r.backoffFor(200); got != r.maxBackoff {
+		t.Errorf("attempt 200 waits %v", got)
+	}
+}
+
+// failingServer serves data, answering GETs with 503 while failing is set
+func failingServer(t *testing.T, data []byte, failing *int32) (*httptest.Server, *int64) {
+	var requests int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if req.Method == http.MethodGet && atomic.LoadInt32(failing) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func TestRetryBudget(t *testing.T) {
+	failing := int32(1)
+	s, requests := failingServer(t, testData(1000), &failing)
+	r, err := NewReader(s.URL, 0, WithRetries(10, time.Millisecond), WithRetryBudget(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	before := atomic.LoadInt64(requests)
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Fatal("read succeeded against a failing server")
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 4 {
+		t.Fatalf("%d requests, want the first and 3 budgeted retries", got)
+	}
+	before = atomic.LoadInt64(requests)
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Fatal("read succeeded against a failing server")
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 1 {
+		t.Fatalf("%d requests once the budget is spent, want 1", got)
+	}
+	if r.Stats().Retries != 3 {
+		t.Fatalf("%d retries recorded", r.Stats().Retries)
+	}
+}
+
+func TestStaleConnectionRetry(t *testing.T) {
+	data := testData(10000)
+	var gets, conns int64
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			// The GET then goes out on a new connection, which net/http
+			// doesn't retry by itself when it's reset
+			w.Header().Set("Connection", "close")
+		}
+		if req.Method == http.MethodGet && atomic.AddInt64(&gets, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// Close with a RST rather than a FIN
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	s.Start()
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if _, err := r.ReadAt(buf, 5000); err != nil || !bytes.Equal(buf, data[5000:5100]) {
+		t.Fatalf("read after a reset: %v", err)
+	}
+	if n := atomic.LoadInt64(&gets); n != 2 {
+		t.Fatalf("got %d GETs, want the reset one repeated once", n)
+	}
+	// The HEAD's, the reset one's and the repeat's
+	if n := atomic.LoadInt64(&conns); n != 3 {
+		t.Fatalf("got %d connections, want 3", n)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	data := testData(10000)
+	var gets int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && atomic.AddInt64(&gets, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	// The backoff alone would retry right away
+	r, err := NewReader(s.URL, 0, WithRetries(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	start := time.Now()
+	if _, err := r.ReadAt(buf, 100); err != nil || !bytes.Equal(buf, data[100:200]) {
+		t.Fatalf("read after a 429: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("retried after %v, want the second asked for", elapsed)
+	}
+}
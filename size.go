@@ -0,0 +1,151 @@
+package urlreadseeker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxHeadBody is how much of a stray HEAD body is drained
+const maxHeadBody = 64 * 1024
+
+// size learns the file size trying each probe method in turn. A method
+// that gets a bad status or no usable length falls through to the next, as
+// does a HEAD whose connection fails
+// TODO can technically skip this if prefetch is set
+func (r *Reader) size(ctx context.Context) (contentSize int64, err error) {
+	if len(r.probeMethods) == 0 {
+		return 0, errors.New("no size probe methods")
+	}
+	for _, method := range r.probeMethods {
+		switch method {
+		case http.MethodHead:
+			contentSize, err = r.headSize(ctx)
+		case http.MethodGet:
+			contentSize, err = r.probeSize(ctx)
+		default:
+			return 0, fmt.Errorf("unsupported size probe method %q", method)
+		}
+		err = connectError(method, err)
+		if err == nil || !r.probeFallsThrough(ctx, method, err) {
+			return contentSize, err
+		}
+	}
+	return 0, err
+}
+
+// connectError wraps a failure to reach the server at all in a
+// *ConnectError naming the probe method
+func connectError(method string, err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &ConnectError{Method: method, Err: err}
+}
+
+// probeFallsThrough reports whether the next probe method should be tried
+// after err
+func (r *Reader) probeFallsThrough(ctx context.Context, method string, err error) bool {
+	var status *StatusError
+	if errors.Is(err, ErrNoContentLength) || errors.As(err, &status) {
+		return true
+	}
+	// A truncated or reset HEAD says nothing about the GET, unless the
+	// reader is being given up on
+	return method == http.MethodHead && ctx.Err() == nil && !errors.Is(err, ErrRequestBudgetExceeded)
+}
+
+// headSize learns the size from the Content-Length of a HEAD
+func (r *Reader) headSize(ctx context.Context) (int64, error) {
+	url, err := r.requestURL(ctx)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := r.do(req)
+	if err != nil {
+		return 0, err
+	}
+	// HEAD bodies should be empty but some servers send one anyway, drain
+	// it so a broken connection shows up here rather than being trusted
+	_, err = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxHeadBody))
+	if closeErr := resp.Body.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode/100 != 2 {
+		// Pre-signed urls are often only valid for GET, 403 or 405 here
+		return 0, newStatusError(resp)
+	}
+	r.etag = resp.Header.Get("ETag")
+	r.lastModified = resp.Header.Get("Last-Modified")
+	r.gzipEncoded = r.transparentGzip && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+	r.rangesRefused = strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "none")
+	s := resp.Header.Get("Content-Length")
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, ErrNoContentLength
+	}
+
+	return size, nil
+}
+
+// probeSize learns the size from the Content-Range total of a one byte GET,
+// for servers whose HEAD is refused or has no usable Content-Length
+func (r *Reader) probeSize(ctx context.Context) (int64, error) {
+	req, err := r.newRequest(ctx, 0, 1)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := r.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	r.gzipEncoded = r.transparentGzip && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		r.etag = resp.Header.Get("ETag")
+		r.lastModified = resp.Header.Get("Last-Modified")
+		first, _, total, err := parseContentRange(resp.Header.Get("Content-Range"), r.rangeUnit)
+		if err != nil || total < 0 {
+			return 0, ErrNoContentLength
+		}
+		if first != 0 {
+			// The total is still good but the bytes aren't the ones asked for
+			r.rangesRefused = true
+			return total, nil
+		}
+		// Seed the head with the byte we paid for, unless it is compressed
+		if head, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1)); err == nil && !r.gzipEncoded && r.gzip == nil {
+			r.head = head
+		}
+		return total, nil
+	case http.StatusOK:
+		// Ranges are ignored, the full body's length is the size. Only a
+		// one byte file was answered in full legitimately
+		r.rangesRefused = resp.ContentLength != 1
+		if resp.ContentLength < 0 {
+			return 0, ErrNoContentLength
+		}
+		return resp.ContentLength, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Even the first byte is out of range, "bytes */0"
+		return 0, nil
+	}
+	return 0, newStatusError(resp)
+}
@@ -0,0 +1,186 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNegativeContentLength(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	// net/http refuses to send or parse a negative length, fake the HEAD
+	negativeHead := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodHead {
+			return http.DefaultTransport.RoundTrip(req)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Length": {"-5"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+	r, err := NewReader(s.URL, 0, WithTransport(negativeHead))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d, want %d from the GET probe", r.Size(), len(data))
+	}
+	_, err = NewReader(s.URL, 0, WithTransport(negativeHead), WithSizeProbeMethods([]string{http.MethodHead}))
+	if !errors.Is(err, ErrNoContentLength) {
+		t.Fatalf("got %v, want ErrNoContentLength", err)
+	}
+}
+
+func TestInconsistentSize(t *testing.T) {
+	data := testData(1000)
+	s := lyingHeadServer(t, data, "100")
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, 50); !errors.Is(err, ErrInconsistentSize) {
+		t.Fatalf("got %v, want ErrInconsistentSize", err)
+	}
+}
+
+// getOnlyServer refuses HEAD the way pre-signed GET urls do
+func getOnlyServer(t *testing.T, data []byte) (*httptest.Server, *int64) {
+	var heads int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			atomic.AddInt64(&heads, 1)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	return s, &heads
+}
+
+func TestSizeFromRangeProbe(t *testing.T) {
+	data := testData(1000)
+	s, _ := getOnlyServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d", r.Size())
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf[:n], data[:100]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+}
+
+func TestRangeProbeSkipsCompressedHead(t *testing.T) {
+	data := testData(50000)
+	compressed := gzipMembers(t, data, 10000)
+	index, err := BuildGzipIndex(bytes.NewReader(compressed), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := getOnlyServer(t, compressed)
+	r, err := NewReader(s.URL, 0, WithGzipIndex(index), WithSizeProbeMethods([]string{http.MethodGet}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if n, err := r.ReadAt(buf, 0); err != nil || !bytes.Equal(buf[:n], data[:4]) {
+		t.Fatalf("got %q, %v, want decompressed bytes", buf[:n], err)
+	}
+}
+
+func TestGetOnlyProbe(t *testing.T) {
+	data := testData(1000)
+	s, heads := getOnlyServer(t, data)
+	r, err := NewReader(s.URL, 0, WithSizeProbeMethods([]string{http.MethodGet}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d", r.Size())
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 300); err != nil || !bytes.Equal(buf[:n], data[300:400]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(heads); got != 0 {
+		t.Fatalf("%d HEAD requests", got)
+	}
+}
+
+func TestAbruptHeadFallsBack(t *testing.T) {
+	data := testData(10000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			// The length arrives but the headers are never finished
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n", len(data))
+			buf.Flush()
+			conn.Close()
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d, want %d", r.Size(), len(data))
+	}
+	buf := make([]byte, 100)
+	if _, err := r.ReadAt(buf, 9900); err != nil || !bytes.Equal(buf, data[9900:]) {
+		t.Fatalf("read the tail: %v", err)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String() + "/file"
+	l.Close()
+
+	for _, url := range []string{"http://files.invalid/file", refused} {
+		_, err := NewReader(url, 0, WithNoProxy())
+		var connect *ConnectError
+		if !errors.As(err, &connect) || !errors.Is(err, ErrConnect) {
+			t.Fatalf("%s: got %v, want a *ConnectError", url, err)
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) {
+			t.Fatalf("%s: got %v, want a net.Error inside", url, err)
+		}
+	}
+	_, err = NewReader(refused, 0, WithNoProxy())
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Fatalf("got %v, want ECONNREFUSED", err)
+	}
+}
@@ -0,0 +1,88 @@
+package urlreadseeker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// ReadTail returns the last n bytes of the file, or all of it if shorter,
+// using a suffix range (bytes=-n) so no known size is needed. When the size
+// is unknown it is learned from the Content-Range total
+func (r *Reader) ReadTail(n int) ([]byte, error) {
+	if n <= 0 {
+		return []byte{}, nil
+	}
+	if r.gzipEncoded {
+		return nil, ErrGzipEncoded
+	}
+	if r.inline {
+		start := len(r.head) - n
+		if start < 0 {
+			start = 0
+		}
+		return append([]byte{}, r.head[start:]...), nil
+	}
+	if r.gzip != nil {
+		// The suffix of the compressed file is only its trailer
+		start := r.gzip.Size - int64(n)
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, r.gzip.Size-start)
+		total, err := r.ReadAt(buf, start)
+		if err == io.EOF && total == len(buf) {
+			err = nil
+		}
+		return buf[:total], err
+	}
+
+	req, err := r.newRequest(r.ctx, -int64(n), -1)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if err := r.checkContentRange(resp.Header.Get("Content-Range")); err != nil {
+			return nil, err
+		}
+		cr := resp.Header.Get("Content-Range")
+		_, last, total, err := parseContentRange(cr, r.rangeUnit)
+		if err == nil && total >= 0 && last != total-1 {
+			// A suffix range must end with the file
+			return nil, fmt.Errorf("%w: asked for the last %d bytes, got %q", ErrRangeMismatch, n, cr)
+		}
+		if err == nil && total >= 0 && r.lockedSize() < 0 {
+			r.mu.Lock()
+			r.contentSize = total
+			r.mu.Unlock()
+		}
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusOK:
+		// The whole file, keep its tail
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if r.lockedSize() < 0 {
+			r.mu.Lock()
+			r.contentSize = int64(len(body))
+			r.mu.Unlock()
+		}
+		if len(body) > n {
+			body = body[len(body)-n:]
+		}
+		return body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Empty file
+		return []byte{}, nil
+	}
+	return nil, newStatusError(resp)
+}
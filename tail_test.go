@@ -0,0 +1,53 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadTailUnknownSize(t *testing.T) {
+	data := testData(1000)
+	size := int64(len(data))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		spec := req.Header.Get("Range")
+		_, first, last, ok := parseRangeSpec(spec, size)
+		if !ok {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		// Only a suffix range tells the total
+		total := "*"
+		if strings.HasPrefix(spec, "bytes=-") {
+			total = fmt.Sprint(size)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", first, last, total))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[first : last+1])
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0, WithAllowUnknownSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != -1 {
+		t.Fatalf("size %d, want unknown", r.Size())
+	}
+	tail, err := r.ReadTail(16)
+	if err != nil || !bytes.Equal(tail, data[len(data)-16:]) {
+		t.Fatalf("got %d bytes, %v", len(tail), err)
+	}
+	if r.Size() != size {
+		t.Fatalf("size %d after the suffix range, want %d", r.Size(), size)
+	}
+	if tail, err := r.ReadTail(5000); err != nil || !bytes.Equal(tail, data) {
+		t.Fatalf("tail longer than the file: %d bytes, %v", len(tail), err)
+	}
+}
@@ -0,0 +1,126 @@
+package urlreadseeker
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// setupClient replaces the default client when options ask for a custom
+// client, transport, transport settings or middleware
+func (r *Reader) setupClient() error {
+	if r.groupClient != nil {
+		r.client = r.groupClient
+		return nil
+	}
+	base, err := r.baseTransport()
+	if err != nil {
+		return err
+	}
+	if r.userClient != nil {
+		if base != nil {
+			return fmt.Errorf("%w: transport settings can't be applied to WithClient", ErrOptionConflict)
+		}
+		if len(r.middleware) == 0 {
+			r.client = r.userClient
+			return nil
+		}
+		// Wrap a copy, the caller's client may be shared
+		c := *r.userClient
+		c.Transport = r.wrapTransport(c.Transport)
+		r.client = &c
+		return nil
+	}
+	if base == nil && len(r.middleware) == 0 {
+		// http.DefaultClient already honors HTTP_PROXY and friends
+		return nil
+	}
+	r.client = &http.Client{Transport: r.wrapTransport(base)}
+	return nil
+}
+
+// wrapTransport applies the WithRoundTripperMiddleware wrappers to base, nil
+// meaning http.DefaultTransport
+func (r *Reader) wrapTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for _, mw := range r.middleware {
+		base = mw(base)
+	}
+	return base
+}
+
+// baseTransport returns the transport the options call for, nil when the
+// default one will do
+func (r *Reader) baseTransport() (http.RoundTripper, error) {
+	if r.transport != nil {
+		if r.tlsConfig != nil {
+			return nil, fmt.Errorf("%w: TLS settings can't be applied to WithTransport", ErrOptionConflict)
+		}
+		if r.noProxy {
+			return nil, fmt.Errorf("%w: WithNoProxy can't be applied to WithTransport", ErrOptionConflict)
+		}
+		if r.maxIdleConns > 0 || r.maxConnsPerHost > 0 {
+			return nil, fmt.Errorf("%w: connection pool settings can't be applied to WithTransport", ErrOptionConflict)
+		}
+		return r.transport, nil
+	}
+	if r.tlsConfig == nil && !r.noProxy && r.maxIdleConns <= 0 && r.maxConnsPerHost <= 0 {
+		return nil, nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyFromEnvironment
+	if r.noProxy {
+		t.Proxy = nil
+	}
+	t.TLSClientConfig = r.tlsConfig
+	if r.maxIdleConns > 0 {
+		t.MaxIdleConns = r.maxIdleConns
+		t.MaxIdleConnsPerHost = r.maxIdleConns
+	}
+	if r.maxConnsPerHost > 0 {
+		t.MaxConnsPerHost = r.maxConnsPerHost
+	}
+	return t, nil
+}
+
+// tlsSettings returns the TLS config being built by the options, creating it if needed
+func (r *Reader) tlsSettings() *tls.Config {
+	if r.tlsConfig == nil {
+		r.tlsConfig = &tls.Config{}
+	}
+	return r.tlsConfig
+}
+
+// clientKey carries a one-off client from freshClient to the requests of
+// the read it was made for
+type clientKey struct{}
+
+// freshClient returns a client like the reader's whose requests can't reuse
+// a pooled connection, and a func dropping its connections once done with.
+// It is for repeating a request that found its connection dead: closing the
+// idle connections of the reader's own client instead would flush a pool
+// shared with the rest of the process or a Group. The middleware wrap the
+// one-off transport anew. It returns nil when the transport isn't an
+// *http.Transport, which can't be copied
+func (r *Reader) freshClient() (*http.Client, func()) {
+	var base http.RoundTripper
+	if r.userClient != nil {
+		base = r.userClient.Transport
+	} else if b, err := r.baseTransport(); err == nil {
+		base = b
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, nil
+	}
+	fresh := t.Clone()
+	c := *r.client
+	c.Transport = r.wrapTransport(fresh)
+	return &c, fresh.CloseIdleConnections
+}
@@ -0,0 +1,193 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// selfSignedCert makes a client certificate and a pool trusting it
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestClientCert(t *testing.T) {
+	data := testData(1000)
+	cert, clientCAs := selfSignedCert(t)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	s.StartTLS()
+	defer s.Close()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(s.Certificate())
+
+	if _, err := NewReader(s.URL, 0, WithRootCAs(rootCAs)); err == nil {
+		t.Fatal("connected without a client certificate")
+	}
+	r, err := NewReader(s.URL, 0, WithRootCAs(rootCAs), WithClientCert(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 300); err != nil || !bytes.Equal(buf[:n], data[300:400]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+}
+
+func TestEnvironmentProxy(t *testing.T) {
+	// net/http reads the proxy variables once per process, the test
+	// proper runs in a fresh one
+	if os.Getenv("URLREADSEEKER_PROXY_TEST") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestEnvironmentProxy$")
+		cmd.Env = append(os.Environ(), "URLREADSEEKER_PROXY_TEST=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	data := testData(1000)
+	var proxied int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// A proxy gets the absolute url of a host that doesn't exist
+		if req.URL.Host != "files.invalid" {
+			http.Error(w, "unexpected host "+req.URL.Host, http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt64(&proxied, 1)
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+
+	r, err := NewReader("http://files.invalid/file", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 200); err != nil || !bytes.Equal(buf[:n], data[200:300]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(&proxied); got != 2 {
+		t.Fatalf("%d requests through the proxy, want the HEAD and the read", got)
+	}
+}
+
+// countConns counts the connections s accepts, it must not be started yet
+func countConns(s *httptest.Server) *int64 {
+	var conns int64
+	s.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	return &conns
+}
+
+func TestWarmConnection(t *testing.T) {
+	data := testData(100000)
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	conns := countConns(s)
+	s.Start()
+	defer s.Close()
+	r, err := NewReader(s.URL, 0, WithWarmConnection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.head) == 0 || !bytes.Equal(r.head, data[:len(r.head)]) {
+		t.Fatalf("warm up kept %d bytes", len(r.head))
+	}
+	if got := atomic.LoadInt64(conns); got != 1 {
+		t.Fatalf("HEAD and warm up GET used %d connections, want 1", got)
+	}
+}
+
+func TestConnectionPoolOptions(t *testing.T) {
+	s, _ := newServer(t, testData(100))
+	r, err := NewReader(s.URL, 0, WithMaxIdleConns(7), WithMaxConnsPerHost(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, ok := r.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport is a %T", r.client.Transport)
+	}
+	if tr.MaxIdleConns != 7 || tr.MaxIdleConnsPerHost != 7 || tr.MaxConnsPerHost != 3 {
+		t.Fatalf("MaxIdleConns %d, MaxIdleConnsPerHost %d, MaxConnsPerHost %d",
+			tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost)
+	}
+	if http.DefaultTransport.(*http.Transport).MaxConnsPerHost == 3 {
+		t.Fatal("options changed http.DefaultTransport")
+	}
+}
+
+func TestRoundTripperMiddleware(t *testing.T) {
+	s, requests := newServer(t, testData(1000))
+	var counted int64
+	var order []string
+	count := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt64(&counted, 1)
+			order = append(order, "count")
+			return next.RoundTrip(req)
+		})
+	}
+	tag := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			order = append(order, "tag")
+			return next.RoundTrip(req)
+		})
+	}
+	r, err := NewReader(s.URL, 0, WithRoundTripperMiddleware(count, tag))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{0, 500} {
+		if _, err := r.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt64(&counted); got != atomic.LoadInt64(requests) || got != 3 {
+		t.Fatalf("middleware counted %d requests, the server got %d", got, atomic.LoadInt64(requests))
+	}
+	if order[0] != "tag" || order[1] != "count" {
+		t.Fatalf("middleware ran in order %v, the last given should see requests first", order[:2])
+	}
+}
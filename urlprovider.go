@@ -0,0 +1,39 @@
+package urlreadseeker
+
+import (
+	"context"
+	"time"
+)
+
+// defaultURLSkew is how long before expiry a provided url is replaced
+const defaultURLSkew = 30 * time.Second
+
+// refreshURL asks the url provider for a new url when there is none yet or
+// the current one expires within urlSkew. A zero expiry never expires
+func (r *Reader) refreshURL(ctx context.Context) error {
+	if r.urlProvider == nil {
+		return nil
+	}
+	r.urlMu.Lock()
+	defer r.urlMu.Unlock()
+
+	r.mu.Lock()
+	expiry, provided := r.urlExpiry, r.urlProvided
+	r.mu.Unlock()
+	if provided && (expiry.IsZero() || time.Until(expiry) > r.urlSkew) {
+		return nil
+	}
+
+	url, expiry, err := r.urlProvider(ctx)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.url = url
+	r.urlExpiry = expiry
+	r.urlProvided = true
+	// A new url may redirect somewhere else
+	r.resolvedURL = ""
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,49 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestURLProvider(t *testing.T) {
+	data := testData(1000)
+	firstExpiry := time.Now().Add(200 * time.Millisecond)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sig := req.URL.Query().Get("sig")
+		if sig == "" || sig == "1" && time.Now().After(firstExpiry) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	var calls int64
+	provider := func(ctx context.Context) (string, time.Time, error) {
+		n := atomic.AddInt64(&calls, 1)
+		if n == 1 {
+			return s.URL + "?sig=1", firstExpiry, nil
+		}
+		return fmt.Sprintf("%s?sig=%d", s.URL, n), time.Now().Add(time.Hour), nil
+	}
+	r, err := NewReader("", 0, WithURLProvider(provider), WithURLExpirySkew(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 100); err != nil || !bytes.Equal(buf[:n], data[100:200]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	time.Sleep(time.Until(firstExpiry))
+	if n, err := r.ReadAt(buf, 500); err != nil || !bytes.Equal(buf[:n], data[500:600]) {
+		t.Fatalf("got %d, %v after the first url expired", n, err)
+	}
+	if got := atomic.LoadInt64(&calls); got != 2 {
+		t.Fatalf("provider called %d times, want 2", got)
+	}
+}
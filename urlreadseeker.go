@@ -1,134 +1,1556 @@
 package urlreadseeker
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	urlpkg "net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// inconsistentSizeRatio is how far a Content-Range total may stray from the
+// known size before it's reported as ErrInconsistentSize
+const inconsistentSizeRatio = 2
+
+// warmConnectionPrefetch is the head WithWarmConnection fetches when no
+// prefetch was asked for
+const warmConnectionPrefetch = 4096
+
+// maxPooledBuffer is the largest scratch buffer kept in bodyPool
+const maxPooledBuffer = 4 * 1024 * 1024
+
+// bodyPool recycles the buffers response bodies are read into before being
+// copied to the caller, sparing the GC under high request rates
+var bodyPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// ErrRequestBudgetExceeded is returned once a reader has issued the maximum
+// number of requests allowed by WithMaxRequests
+var ErrRequestBudgetExceeded = errors.New("request budget exceeded")
+
+// ErrOptionConflict is returned by NewReader when options can't be combined
+var ErrOptionConflict = errors.New("conflicting options")
+
+// ErrRangeNotSupported is returned when the server ignores range requests
+// or advertises Accept-Ranges: none. Callers can fall back to a full
+// download, or opt into one with WithAdoptFullBody
+var ErrRangeNotSupported = errors.New("server does not support range requests")
+
+// ErrNoContentLength is returned when the server doesn't report a usable size
+var ErrNoContentLength = errors.New("no content length")
+
+// ErrInconsistentSize is returned when a range response reports a total
+// wildly different from the size the reader learned at construction, or a
+// full body adopted under WithAdoptFullBody isn't that size
+var ErrInconsistentSize = errors.New("inconsistent content size")
+
+// ErrIncompleteRead is returned by Close under WithVerifyComplete when the
+// bytes read don't add up to the file size
+var ErrIncompleteRead = errors.New("incomplete read")
+
+// ErrMissingContentRange is returned when a 206 response has no parsable
+// Content-Range, so the offset of its body can't be checked. One that parses
+// but covers other bytes than asked for is ErrRangeMismatch
+var ErrMissingContentRange = errors.New("206 response without a valid Content-Range")
+
+// ErrRangeMismatch is returned when a 206 response's Content-Range doesn't
+// cover the bytes asked for, its body would land at the wrong offset
+var ErrRangeMismatch = errors.New("206 response for a different range")
+
+// ErrGzipEncoded is returned by random-access reads, seeks, ranges and tails
+// of a reader with WithTransparentGzip over a source served with
+// Content-Encoding: gzip, whose byte ranges are of the compressed form. Only
+// Stream, WriteTo and ReadAll can read it
+var ErrGzipEncoded = errors.New("gzip encoded source can only be read whole")
+
+// ErrGzipSingleMember is returned by BuildGzipIndex for a file written as
+// a single gzip member longer than the span, which has no access points
+// past its start for random access
+var ErrGzipSingleMember = errors.New("single member gzip file has no access points")
+
+// ErrInvalidOption is returned by NewReader for an option given a value it
+// can't use
+var ErrInvalidOption = errors.New("invalid option")
+
+// ErrNoCache is returned by WarmCache on a reader without a block cache
+var ErrNoCache = errors.New("no block cache")
+
+// ErrCacheBudget is returned by WarmCache for ranges that don't fit in the
+// block cache
+var ErrCacheBudget = errors.New("ranges exceed the block cache")
+
+// ErrNegativeOffset is returned by reads at an offset before the start of
+// the file
+var ErrNegativeOffset = errors.New("negative offset")
+
+// ErrRangeOutOfBounds is returned by WarmCache for a range ending before it
+// starts or starting past the end of the file
+var ErrRangeOutOfBounds = errors.New("range out of bounds")
+
+// ErrSeekOutOfBounds is returned by Seek under WithSeekValidation for an
+// offset past the end of the file
+var ErrSeekOutOfBounds = errors.New("seek out of bounds")
+
+// ErrInvalidURL is returned by NewReader for urls that can't be fetched
+var ErrInvalidURL = errors.New("invalid url")
+
+// ErrConnect matches, with errors.Is, the *ConnectError NewReader returns
+// when it can't reach the server
+var ErrConnect = errors.New("connection failed")
+
+// ConnectError is a DNS, connection or TLS failure reaching the server while
+// learning the size. errors.As reaches the underlying *net.DNSError,
+// *net.OpError or TLS error through it
+type ConnectError struct {
+	// Method is the size probe that failed, HEAD or the GET fallback
+	Method string
+	Err    error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("%v during %s: %v", ErrConnect, e.Method, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrConnect) match any ConnectError
+func (e *ConnectError) Is(target error) bool {
+	return target == ErrConnect
+}
+
+// maxErrorBody bounds the body kept by a StatusError
+const maxErrorBody = 4096
+
+// StatusError is returned when the server answers with an unexpected status
+type StatusError struct {
+	StatusCode int
+	// Header is the response's headers
+	Header http.Header
+	// Body is the start of the response body, at most 4KiB, often an XML
+	// or JSON description of the error
+	Body []byte
+}
+
+// newStatusError describes a bad response, reading the start of its body.
+// The caller still closes the body
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return &StatusError{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Bad status code: %d", e.StatusCode)
+}
+
+// RetryAfter returns the wait the server asked for with Retry-After, given
+// either in seconds or as a date
+func (e *StatusError) RetryAfter() (time.Duration, bool) {
+	return retryAfter(e.Header)
+}
+
 // Reader implements io.ReadSeeker with http range requests
 type Reader struct {
-	client      *http.Client
-	url         string
+	// mu guards the state touched by fetches that run concurrently, like
+	// WarmCache, or observed by State: counters, credentials, the resolved
+	// url, offset and size updates. Read and Seek themselves are not safe
+	// for concurrent use
+	mu sync.Mutex
+	// urlMu serializes calls to the url provider
+	urlMu sync.Mutex
+
+	readerState
+}
+
+// readerState is everything in a Reader except its lock, so it can be
+// copied by Clone
+type readerState struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *http.Client
+	url    string
+	// key identifies the file in a shared cache, it stays put when a url
+	// provider hands out new urls
+	key         string
 	offset      int64
 	contentSize int64
 	head        []byte
+
+	maxRequests int
+	// budgetUsed counts requests against maxRequests, shared with clones
+	budgetUsed   *int64
+	requests     int
+	maxRangeSize int64
+
+	cache     Cache
+	blockSize int64
+	// privateCache is set when the reader created its own cache
+	privateCache sizedCache
+	// lruBlocks is the WithBlockCache capacity, 0 without one
+	lruBlocks int
+	// sharedCache is set by WithSharedCache, in whichever order it comes
+	// with WithBlockCache
+	sharedCache bool
+	// blockReadAhead is how many blocks past a miss are fetched with it
+	blockReadAhead int
+
+	sizeStale bool
+
+	authHandler   func(challenge string) (string, error)
+	authorization string
+
+	transport http.RoundTripper
+	tlsConfig *tls.Config
+	noProxy   bool
+
+	maxIdleConns    int
+	maxConnsPerHost int
+	middleware      []func(http.RoundTripper) http.RoundTripper
+	// groupClient is the client shared by every reader a Group opens
+	groupClient *http.Client
+
+	// inline is set once head holds the whole file, either a decoded data:
+	// url or a full body adopted from a server ignoring ranges
+	inline    bool
+	adoptFull bool
+	// rangesRefused is set once the server is known not to serve ranges,
+	// from Accept-Ranges: none, a 200 to a range request or a 206 for the
+	// wrong range. Guarded by mu
+	rangesRefused bool
+
+	// gzip, when set, exposes the decompressed content of a gzip file
+	gzip *GzipIndex
+
+	resolvedURL string
+	pinRedirect bool
+	resolver    func(url string, start, end int64) (string, error)
+
+	accept         string
+	warmConnection bool
+
+	// Validators from the size probe, used by RefreshSize
+	etag         string
+	lastModified string
+
+	rangeUnit string
+
+	// rangeRejectStatus are the statuses that make fetches halve the range
+	rangeRejectStatus []int
+
+	urlProvider func(ctx context.Context) (string, time.Time, error)
+	urlSkew     time.Duration
+	urlExpiry   time.Time
+	urlProvided bool
+
+	// probeMethods are tried in order to learn the size
+	probeMethods []string
+
+	requestIDHeader string
+	requestIDGen    func() string
+
+	allowUnknownSize bool
+
+	retries     int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retryBudget int
+	retried     int
+
+	onChunk func(start int64, data []byte)
+
+	lenientContentRange bool
+
+	// maxReadAhead caps the buffer of Buffered
+	maxReadAhead int
+
+	metrics Collector
+
+	// copyBufferSize is the buffer for WriteTo, Stream and CopyN copies,
+	// 0 to let io.Copy choose
+	copyBufferSize int
+
+	seekValidation bool
+
+	// userClient is the WithClient client
+	userClient *http.Client
+	// headers are the WithHeader headers sent with every request
+	headers http.Header
+	// prefetch is the WithPrefetch head size
+	prefetch int
+
+	// concurrency is how many chunks WriteTo downloads at once
+	concurrency int
+	// inFlight is the WithMaxInFlight semaphore, shared with clones
+	inFlight chan struct{}
+
+	prefetchRequired bool
+	// prefetchErr is why the best-effort prefetch failed
+	prefetchErr error
+	// refreshErr is why the last WithSizeTTL refresh failed, guarded by mu
+	refreshErr error
+
+	// smallFileThreshold is the size up to which open downloads the file
+	smallFileThreshold int64
+
+	// sizeTTL is how long the size is trusted before reads refresh it
+	sizeTTL     time.Duration
+	sizeChecked time.Time
+	// keyVersion tells the blocks of a changed file apart in the cache
+	keyVersion string
+
+	rangeValidator func(resp *http.Response, reqStart, reqEnd int64) (bodyStart int64, err error)
+
+	// optionErr is the first invalid option value, reported by NewReader
+	optionErr error
+
+	transparentGzip bool
+	// gzipEncoded is set when the size probe saw Content-Encoding: gzip
+	gzipEncoded bool
+
+	verifyComplete bool
+	// consumed counts the bytes delivered by sequential reads
+	consumed int64
+}
+
+// Stats holds counters describing the work a Reader has done
+type Stats struct {
+	// Requests is the number of http requests issued, including the HEAD
+	Requests int
+	// CachedBytes is the memory held by the head and any private block cache
+	CachedBytes int64
+	// Retries is the number of requests repeated after a transient failure
+	Retries int
 }
 
 // NewReader creates a new reader for the given url
 // prefetch is an optional number of bytes to cache for headers
-func NewReader(url string, prefetch int) (*Reader, error) {
-	r := &Reader{
-		url:    url,
-		client: http.DefaultClient,
-		head:   []byte{},
+func NewReader(url string, prefetch int, opts ...Option) (*Reader, error) {
+	return NewReaderContext(context.Background(), url, prefetch, opts...)
+}
+
+// NewReaderContext is like NewReader but ctx bounds the reader's lifetime,
+// the size probe, prefetch and every later request are cancelled with it
+func NewReaderContext(ctx context.Context, url string, prefetch int, opts ...Option) (*Reader, error) {
+	r := newReader(ctx, url, opts)
+	if err := r.open(prefetch); err != nil {
+		r.cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// newReader applies opts over the defaults, making no requests
+func newReader(ctx context.Context, url string, opts []Option) *Reader {
+	r := &Reader{readerState: readerState{
+		url:       url,
+		key:       url,
+		client:    http.DefaultClient,
+		head:      []byte{},
+		blockSize: defaultBlockSize,
+		rangeUnit: "bytes",
+
+		rangeRejectStatus: []int{http.StatusRequestEntityTooLarge},
+		probeMethods:      []string{http.MethodHead, http.MethodGet},
+		maxBackoff:        defaultMaxBackoff,
+		urlSkew:           defaultURLSkew,
+		metrics:           noopCollector{},
+	}}
+	// Close cancels this context to abort any requests still in flight
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewReaderWithOptions is NewReaderContext configured by options alone,
+// the head size coming from WithPrefetch
+func NewReaderWithOptions(ctx context.Context, url string, opts ...Option) (*Reader, error) {
+	return NewReaderContext(ctx, url, 0, opts...)
+}
+
+// open sets the reader up: it builds the client, learns the size and
+// prefetches the head
+func (r *Reader) open(prefetch int) error {
+	if prefetch <= 0 {
+		prefetch = r.prefetch
+	}
+	if err := r.prepare(); err != nil {
+		return err
+	}
+	if isDataURL(r.url) {
+		return r.loadDataURL()
+	}
+	size, err := r.size(r.ctx)
+	if errors.Is(err, ErrNoContentLength) && r.allowUnknownSize {
+		// Reads go to the server and learn the end of the file as they hit it
+		size, err = -1, nil
 	}
-	size, err := r.size()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	r.contentSize = size
+	r.sizeChecked = time.Now()
 
+	if r.gzipEncoded {
+		// The head would be compressed bytes nothing can read
+		return nil
+	}
+	if r.warmConnection && prefetch <= 0 {
+		// Follow the HEAD with a GET while its connection is still idle in the pool
+		prefetch = warmConnectionPrefetch
+	}
+	// A stale or unknown size can't promise the prefetch holds the whole file
+	small := r.smallFileThreshold > 0 && r.gzip == nil && r.sizeTrusted() && size <= r.smallFileThreshold
+	if small {
+		// One GET for the whole file beats a round trip per read
+		prefetch = int(size)
+	}
+	if size := r.logicalSize(); size >= 0 && int64(prefetch) > size {
+		// Never ask for more than the file holds, the head must agree with contentSize
+		prefetch = int(r.logicalSize())
+	}
 	if prefetch > 0 {
 		head := make([]byte, prefetch)
 		total, err := r.ReadAt(head, 0)
-		if err != nil {
-			head = []byte{}
-			fmt.Printf("Error prefetching head %v\n", err)
+		if err != nil && err != io.EOF {
+			if r.prefetchRequired {
+				return fmt.Errorf("prefetching head: %w", err)
+			}
+			total = 0
+			r.prefetchErr = err
 		}
-		if len(head) > total {
-			head = head[:total]
+		// Keep exactly the bytes the server sent, a short 206 leaves the rest zeroed
+		r.head = head[:total]
+	}
+	if small && int64(len(r.head)) == size {
+		r.inline = true
+	}
+
+	return nil
+}
+
+// prepare resolves and checks the url and builds the client
+func (r *Reader) prepare() error {
+	if r.optionErr != nil {
+		return r.optionErr
+	}
+	if r.lruBlocks > 0 && r.sharedCache {
+		return fmt.Errorf("%w: WithBlockCache and WithSharedCache", ErrOptionConflict)
+	}
+	if r.urlProvider != nil {
+		if err := r.refreshURL(r.ctx); err != nil {
+			return err
 		}
-		r.head = head
+		if r.key == "" {
+			r.key = r.url
+		}
+	}
+	if err := validateURL(r.url); err != nil {
+		return err
 	}
+	return r.setupClient()
+}
 
-	return r, nil
+// Close cancels any requests still in flight, they return an error wrapping
+// context.Canceled, as does every later read. Closing a reader also closes
+// its clones. With WithVerifyComplete it returns ErrIncompleteRead unless
+// exactly the whole file was read
+func (r *Reader) Close() error {
+	r.cancel()
+	if r.verifyComplete {
+		r.mu.Lock()
+		consumed, size := r.consumed, r.logicalSize()
+		r.mu.Unlock()
+		if consumed != size {
+			return fmt.Errorf("%w: read %d of %d bytes", ErrIncompleteRead, consumed, size)
+		}
+	}
+	return nil
+}
+
+// validateURL checks that url is absolute and uses a supported scheme
+func validateURL(url string) error {
+	if isDataURL(url) {
+		return nil
+	}
+	u, err := urlpkg.Parse(url)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "":
+		return fmt.Errorf("%w: %q is not absolute", ErrInvalidURL, url)
+	default:
+		return fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%w: %q has no host", ErrInvalidURL, url)
+	}
+	return nil
 }
 
+// Seek implements io.Seeker. Seeking before the start of the file is an
+// error, as is seeking from the end of a file of unknown size
 func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	if r.gzipEncoded {
+		return r.offset, ErrGzipEncoded
+	}
+	var target int64
 	switch whence {
 	case io.SeekStart:
-		r.offset = offset
+		target = offset
 	case io.SeekCurrent:
-		r.offset += offset
+		target = r.offset + offset
 	case io.SeekEnd:
-		// This might work? Untested
-		r.offset = r.contentSize - offset
+		size := r.Size()
+		if size < 0 {
+			return r.offset, errors.New("can't seek from the end, size unknown")
+		}
+		target = size + offset
 	default:
 		return 0, fmt.Errorf("Mode not implemented: %v", whence)
 	}
+	if target < 0 {
+		return r.offset, fmt.Errorf("%w: seek to %d", ErrNegativeOffset, target)
+	}
+	if r.seekValidation {
+		if size := r.Size(); size >= 0 && target > size {
+			return r.offset, fmt.Errorf("%w: %d past size %d", ErrSeekOutOfBounds, target, size)
+		}
+	}
+	r.setOffset(target)
 	return r.offset, nil
 }
 
+// advance moves the cursor forward over n bytes handed to the caller
+func (r *Reader) advance(n int64) {
+	r.mu.Lock()
+	r.offset += n
+	r.consumed += n
+	r.mu.Unlock()
+}
+
+// setOffset moves the cursor. Only the goroutine using the reader moves it,
+// the lock is for State
+func (r *Reader) setOffset(offset int64) {
+	r.mu.Lock()
+	r.offset = offset
+	r.mu.Unlock()
+}
+
 // Read len(buf) bytes from the remote file into buf
 func (r *Reader) Read(buf []byte) (n int, err error) {
-	n, err = r.read(buf, r.offset)
-	r.offset += int64(n)
+	n, err = r.read(r.ctx, buf, r.offset)
+	r.advance(int64(n))
+	return n, err
+}
+
+// Range is the span of bytes [Start, End) within the file
+type Range struct {
+	Start, End int64
+}
+
+// ReadAtLeast reads into buf until it has read at least min bytes, like
+// io.ReadAtLeast. It returns io.ErrUnexpectedEOF if the file ends first and
+// io.ErrShortBuffer if min is larger than buf. The offset advances by n
+func (r *Reader) ReadAtLeast(buf []byte, min int) (n int, err error) {
+	if len(buf) < min {
+		return 0, io.ErrShortBuffer
+	}
+	for n < min && err == nil {
+		var nn int
+		nn, err = r.Read(buf[n:])
+		if nn == 0 && err == nil {
+			err = io.ErrNoProgress
+		}
+		n += nn
+	}
+	if n >= min {
+		err = nil
+	} else if n > 0 && err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
 	return n, err
 }
 
 // ReadAt reads from the remote file at a given offset
 func (r *Reader) ReadAt(buf []byte, offset int64) (n int, err error) {
-	return r.read(buf, offset)
+	return r.read(r.ctx, buf, offset)
+}
+
+// ReadvAt fills bufs in order from the contiguous bytes at offset, fetched
+// as a single read. Like ReadAt it leaves the offset alone. n is the total
+// copied, which is short only alongside an error
+func (r *Reader) ReadvAt(offset int64, bufs [][]byte) (n int, err error) {
+	total := 0
+	for _, buf := range bufs {
+		total += len(buf)
+	}
+	data := make([]byte, total)
+	got, err := r.ReadAt(data, offset)
+	data = data[:got]
+	for _, buf := range bufs {
+		n += copy(buf, data[n:])
+	}
+	return n, err
+}
+
+// ReadAtContext is ReadAt giving up when ctx is done, as well as when the
+// reader is closed
+func (r *Reader) ReadAtContext(ctx context.Context, buf []byte, offset int64) (n int, err error) {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+	return r.read(ctx, buf, offset)
+}
+
+// ReadContext is Read giving up when ctx is done, as well as when the
+// reader is closed
+func (r *Reader) ReadContext(ctx context.Context, buf []byte) (n int, err error) {
+	ctx, cancel := r.readContext(ctx)
+	defer cancel()
+	n, err = r.read(ctx, buf, r.offset)
+	r.advance(int64(n))
+	return n, err
+}
+
+// readContext derives a context from ctx that is also cancelled by Close
+func (r *Reader) readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// ReadAtDeadline is ReadAt giving up at deadline. A read cut short returns
+// the bytes that arrived in time along with an error wrapping
+// context.DeadlineExceeded. Reads through a block cache return no bytes
+// when cut short, since only whole blocks are kept
+func (r *Reader) ReadAtDeadline(buf []byte, offset int64, deadline time.Time) (n int, err error) {
+	ctx, cancel := context.WithDeadline(r.ctx, deadline)
+	defer cancel()
+	return r.read(ctx, buf, offset)
+}
+
+// WriteTo streams the rest of the file from the current offset to w with a
+// single range request and advances the offset, implementing io.WriterTo.
+// Under WithConcurrency large files are fetched in concurrent chunks
+func (r *Reader) WriteTo(w io.Writer) (n int64, err error) {
+	if r.gzipEncoded {
+		return r.writeDecoded(w)
+	}
+	if r.gzip != nil {
+		return r.copyGzip(w, -1)
+	}
+	if r.sizeTrusted() && r.offset >= r.contentSize {
+		return 0, nil
+	}
+	if r.concurrency > 1 && r.sizeTrusted() && !r.inline && r.contentSize-r.offset > r.chunkSize() {
+		return r.writeConcurrent(w)
+	}
+
+	var body io.ReadCloser
+	if r.sizeTrusted() {
+		resp, err := r.openRange(r.ctx, r.offset, r.contentSize)
+		if err != nil {
+			return 0, err
+		}
+		body = resp.Body
+	} else {
+		// The size may be stale, let the server say where the file ends
+		body, err = r.OpenFrom(r.ctx, r.offset)
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer body.Close()
+
+	n, err = r.copyBody(w, body)
+	r.advance(n)
+	return n, err
+}
+
+// writeDecoded is WriteTo for a gzip encoded source, which is only ever
+// read whole from the start
+func (r *Reader) writeDecoded(w io.Writer) (n int64, err error) {
+	if r.offset != 0 {
+		return 0, ErrGzipEncoded
+	}
+	body, err := r.Stream(r.ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err = r.copyBody(w, body)
+	// Past the end, there is nothing left for another WriteTo
+	r.advance(r.contentSize)
+	return n, err
+}
+
+// ReadAll returns the rest of the file from the current offset, read with
+// WriteTo
+func (r *Reader) ReadAll() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	_, err := r.WriteTo(buf)
+	return buf.Bytes(), err
+}
+
+// copyBody copies a response body to w. Writers implementing io.ReaderFrom
+// (files, sockets) get the body directly so they can use their fast path
+// rather than going through an intermediate buffer. With WithCopyBufferSize
+// every copy goes through a buffer of that size instead, so no write is
+// larger
+func (r *Reader) copyBody(w io.Writer, body io.Reader) (int64, error) {
+	if r.copyBufferSize > 0 {
+		// Hide ReaderFrom and WriterTo, io.CopyBuffer would skip the buffer
+		buf := make([]byte, r.copyBufferSize)
+		return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{body}, buf)
+	}
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(body)
+	}
+	return io.Copy(w, body)
+}
+
+// copyBufferBody is a Stream body whose WriteTo copies through the
+// WithCopyBufferSize buffer, so io.Copy of it respects the size too
+type copyBufferBody struct {
+	io.ReadCloser
+	r *Reader
+}
+
+func (b *copyBufferBody) WriteTo(w io.Writer) (int64, error) {
+	return b.r.copyBody(w, b.ReadCloser)
+}
+
+// OpenFrom streams the file from offset to its end using an open-ended
+// range (bytes=offset-), so it doesn't rely on an accurate size. The
+// response must be a 206 unless offset is 0. The caller must close it
+func (r *Reader) OpenFrom(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	if r.gzipEncoded {
+		return nil, ErrGzipEncoded
+	}
+	if r.gzip != nil {
+		body, _, err := r.openGzip(ctx, offset, -1)
+		return body, err
+	}
+	if r.inline {
+		resp, err := r.inlineRange(offset, r.contentSize)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+	if offset > 0 && r.refusesRanges() {
+		return nil, ErrRangeNotSupported
+	}
+	req, err := r.newRequest(ctx, offset, -1)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if err := r.checkContentRange(resp.Header.Get("Content-Range")); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if err := r.checkRangeOffsets(resp.Header.Get("Content-Range"), offset, -1); err != nil {
+			resp.Body.Close()
+			r.refuseRanges()
+			return nil, err
+		}
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK && offset == 0:
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		return nil, io.EOF
+	case http.StatusOK:
+		r.refuseRanges()
+		return nil, ErrRangeNotSupported
+	}
+	return nil, newStatusError(resp)
+}
+
+// CopyN copies n bytes from the current offset to w using a single range
+// request and advances the offset by the bytes written. Like io.CopyN it
+// returns io.EOF if fewer than n bytes remain
+func (r *Reader) CopyN(w io.Writer, n int64) (written int64, err error) {
+	if n <= 0 {
+		return 0, nil
+	}
+	if r.gzipEncoded {
+		return 0, ErrGzipEncoded
+	}
+	if r.gzip != nil {
+		return r.copyGzip(w, n)
+	}
+	end := r.offset + n
+	if r.sizeTrusted() {
+		if r.offset >= r.contentSize {
+			return 0, io.EOF
+		}
+		if end > r.contentSize {
+			end = r.contentSize
+		}
+	}
+
+	resp, err := r.openRange(r.ctx, r.offset, end)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	written, err = r.copyBody(w, io.LimitReader(resp.Body, end-r.offset))
+	r.advance(written)
+	if err == nil && written < n {
+		err = io.EOF
+	}
+	return written, err
 }
 
-func (r *Reader) read(buf []byte, offset int64) (n int, err error) {
+// ReadAtInto returns n bytes starting at offset without copying when it can.
+// If the region lies entirely inside the head or a single cached block the
+// result is a view of the cache: it must be treated as read-only and is only
+// valid until the block is evicted. Otherwise a fresh slice is allocated
+func (r *Reader) ReadAtInto(offset int64, n int) ([]byte, error) {
+	if offset < 0 {
+		return nil, ErrNegativeOffset
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("ReadAtInto: negative length %d", n)
+	}
+	end := offset + int64(n)
+	if end <= int64(len(r.head)) {
+		return r.head[offset:end:end], nil
+	}
+	if r.cache != nil && r.gzip == nil && n > 0 && end <= r.contentSize {
+		start := offset / r.blockSize * r.blockSize
+		if end <= start+r.blockLen(start) {
+			data, err := r.block(r.ctx, start)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(data)) >= end-start {
+				return data[offset-start : end-start : end-start], nil
+			}
+		}
+	}
+
+	buf := make([]byte, n)
+	total, err := r.ReadAt(buf, offset)
+	return buf[:total], err
+}
+
+func (r *Reader) read(ctx context.Context, buf []byte, offset int64) (n int, err error) {
+	if offset < 0 {
+		return 0, ErrNegativeOffset
+	}
+	if len(buf) == 0 {
+		// io.Reader: reading into an empty buffer is a no-op, not EOF
+		return 0, nil
+	}
+	if r.sizeTTL > 0 {
+		r.checkSizeTTL()
+	}
+	if r.gzipEncoded {
+		return 0, ErrGzipEncoded
+	}
+	if r.inline {
+		return r.readInline(buf, offset)
+	}
 	end := offset + int64(len(buf))
-	if int64(len(r.head)) > end {
-		copy(buf, r.head[offset:end])
-		return len(buf), nil
+	if head := int64(len(r.head)); offset < head {
+		// Serve what the head covers, only the rest goes to the server
+		n = copy(buf, r.head[offset:])
+		if int64(n) == end-offset {
+			return n, nil
+		}
+		rest, err := r.read(ctx, buf[n:], head)
+		return n + rest, err
+	}
+	if r.gzip != nil {
+		return r.readGzip(ctx, buf, offset)
 	}
-	if offset >= r.contentSize {
+	if offset >= r.contentSize && r.sizeTrusted() {
 		// Requesting past the end of the file
 		return 0, io.EOF
 	}
 
-	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if r.cache != nil && (r.sizeTrusted() || end <= r.contentSize) {
+		return r.readBlocks(ctx, buf, offset)
+	}
+
+	if end > r.contentSize && r.sizeTrusted() {
+		// Don't ask for bytes past the end, strict servers answer 416
+		end = r.contentSize
+	}
+	body := getBuffer()
+	defer putBuffer(body)
+	if err := r.fetchInto(ctx, body, offset, end, nil); err != nil {
+		// Hand over whatever arrived before the failure
+		return copy(buf, body.Bytes()), err
+	}
+	n = copy(buf, body.Bytes())
+	if !r.sizeTrusted() && offset+int64(n) > r.contentSize {
+		r.mu.Lock()
+		r.contentSize = offset + int64(n)
+		r.mu.Unlock()
+	}
+	if n < len(buf) {
+		// Either the file ends here or the server decided it does
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// OpenRange issues a range request for [start, end) and hands back the live
+// body along with the response headers. The caller must close the body
+func (r *Reader) OpenRange(ctx context.Context, start, end int64) (io.ReadCloser, http.Header, error) {
+	if r.gzipEncoded {
+		return nil, nil, ErrGzipEncoded
+	}
+	if r.gzip != nil {
+		return r.openGzip(ctx, start, end)
+	}
+	resp, err := r.openRange(ctx, start, end)
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, end-1))
+	return resp.Body, resp.Header, nil
+}
 
-	resp, err := r.client.Do(req)
+// Stream opens the whole file as a single forward-only GET, avoiding the
+// per-read range overhead for sequential consumers. The caller must close it
+func (r *Reader) Stream(ctx context.Context) (io.ReadCloser, error) {
+	if r.inline {
+		return ioutil.NopCloser(bytes.NewReader(r.head)), nil
+	}
+	if r.gzip != nil {
+		return r.OpenFrom(ctx, 0)
+	}
+	req, err := r.newRequest(ctx, 0, r.contentSize)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	req.Header.Del("Range")
+
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		err := newStatusError(resp)
+		resp.Body.Close()
+		return nil, err
+	}
+	body, err := r.decodeBody(resp)
+	if err != nil || r.copyBufferSize <= 0 {
+		return body, err
+	}
+	return &copyBufferBody{ReadCloser: body, r: r}, nil
+}
+
+// fetchPolicy returns the bytes in [start, end) in a newly allocated slice
+// along with the caching policy of the responses, for callers storing the
+// bytes in the block cache
+func (r *Reader) fetchPolicy(ctx context.Context, start, end int64) ([]byte, cachePolicy, error) {
+	body := &bytes.Buffer{}
+	policy := cachePolicy{}
+	if err := r.fetchInto(ctx, body, start, end, &policy); err != nil {
+		return nil, policy, err
+	}
+	return body.Bytes(), policy, nil
+}
+
+// fetchInto appends the bytes in [start, end) to body, split into requests
+// of at most maxRangeSize bytes when that is set. The caching headers of
+// the responses are merged into policy unless it is nil
+func (r *Reader) fetchInto(ctx context.Context, body *bytes.Buffer, start, end int64, policy *cachePolicy) error {
+	max := r.rangeLimit()
+	if max <= 0 || end-start <= max {
+		err := r.fetchRange(ctx, body, start, end, policy)
+		if end-start < 2 || !r.rangeRejected(err) {
+			return err
+		}
+		// The server refuses ranges this big, remember a smaller limit
+		r.mu.Lock()
+		r.maxRangeSize = (end - start) / 2
+		r.mu.Unlock()
+		return r.fetchInto(ctx, body, start, end, policy)
+	}
+
+	for pos := start; pos < end; {
+		stop := pos + max
+		if stop > end {
+			stop = end
+		}
+		before := body.Len()
+		err := r.fetchInto(ctx, body, pos, stop, policy)
+		if err == io.EOF && before > 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if int64(body.Len()-before) < stop-pos {
+			// End of file
+			break
+		}
+		pos = stop
+	}
+	return nil
+}
+
+// rangeLimit is the current maximum range size, 0 for none
+func (r *Reader) rangeLimit() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxRangeSize
+}
+
+// rangeRejected reports whether err is the server refusing a range for
+// being too large
+func (r *Reader) rangeRejected(err error) bool {
+	var status *StatusError
+	if !errors.As(err, &status) {
+		return false
+	}
+	for _, code := range r.rangeRejectStatus {
+		if status.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchRange issues a single range request for [start, end) and appends
+// the response to body. A request failing the way a stale keep-alive
+// connection does is repeated once on a new connection
+func (r *Reader) fetchRange(ctx context.Context, body *bytes.Buffer, start, end int64, policy *cachePolicy) error {
+	before := body.Len()
+	err := r.fetchRangeOnce(ctx, body, start, end, policy)
+	if err == nil || ctx.Err() != nil || !staleConnection(err) {
+		return err
+	}
+	body.Truncate(before)
+	if client, done := r.freshClient(); client != nil {
+		defer done()
+		ctx = context.WithValue(ctx, clientKey{}, client)
+	}
+	return r.fetchRangeOnce(ctx, body, start, end, policy)
+}
+
+// fetchRangeOnce is fetchRange without the stale connection retry
+func (r *Reader) fetchRangeOnce(ctx context.Context, body *bytes.Buffer, start, end int64, policy *cachePolicy) error {
+	resp, err := r.openRange(ctx, start, end)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
+	if policy != nil {
+		policy.merge(parseCachePolicy(resp.Header, time.Now()))
+	}
+
+	before := body.Len()
+	body.Grow(int(end - start))
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+	if r.onChunk != nil {
+		r.onChunk(start, body.Bytes()[before:])
+	}
+	return nil
+}
+
+// getBuffer takes a scratch buffer from bodyPool
+func getBuffer() *bytes.Buffer {
+	body := bodyPool.Get().(*bytes.Buffer)
+	body.Reset()
+	return body
+}
+
+// putBuffer returns a scratch buffer to bodyPool, large ones are left to the
+// GC so a single big read doesn't pin its memory
+func putBuffer(body *bytes.Buffer) {
+	if body.Cap() <= maxPooledBuffer {
+		bodyPool.Put(body)
+	}
+}
+
+// openRange sends a range request for [start, end) and checks the status,
+// on success the caller owns resp.Body
+func (r *Reader) openRange(ctx context.Context, start, end int64) (*http.Response, error) {
+	if r.inline {
+		return r.inlineRange(start, end)
+	}
+	if !r.adoptFull && (start > 0 || end < r.lockedSize()) && r.refusesRanges() {
+		// Don't pay for a full body that would only be thrown away
+		return nil, ErrRangeNotSupported
+	}
+	req, err := r.newRequest(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.rangeValidator != nil {
+		return r.validatedRange(resp, start, end)
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// The range starts at or past the end of the file
+		resp.Body.Close()
+		return nil, io.EOF
+	}
 	if resp.StatusCode/100 != 2 {
-		return 0, fmt.Errorf("Bad status code: %d", resp.StatusCode)
+		err := newStatusError(resp)
+		resp.Body.Close()
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		if err := r.checkContentRange(resp.Header.Get("Content-Range")); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if err := r.checkRangeOffsets(resp.Header.Get("Content-Range"), start, end); err != nil {
+			resp.Body.Close()
+			r.refuseRanges()
+			return nil, err
+		}
+		if err := r.reconcileSize(resp.Header.Get("Content-Range")); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if resp.StatusCode == http.StatusOK && (start > 0 || end < r.lockedSize()) {
+		// The server ignored the range and sent the whole file
+		return r.adoptFullBody(resp, start, end)
 	}
+	return resp, nil
+}
+
+// validatedRange checks resp with the WithRangeResponseValidator callback
+// in place of the usual status handling, then trims the body to the bytes
+// in [start, end)
+func (r *Reader) validatedRange(resp *http.Response, start, end int64) (*http.Response, error) {
+	bodyStart, err := r.rangeValidator(resp, start, end)
+	if err == nil && (bodyStart < 0 || bodyStart > start) {
+		err = fmt.Errorf("range response body starts at %d, requested %d", bodyStart, start)
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, resp.Body, start-bodyStart); err != nil {
+		// io.EOF when the body ends before the range begins
+		resp.Body.Close()
+		return nil, err
+	}
+	if end >= 0 {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, end-start), resp.Body}
+	}
+	return resp, nil
+}
 
+// adoptFullBody handles a 200 answer to a range request. With
+// WithAdoptFullBody the body is kept in memory and every later read is
+// served from it, as long as it is as long as the known size, otherwise the
+// response is rejected
+func (r *Reader) adoptFullBody(resp *http.Response, start, end int64) (*http.Response, error) {
+	defer resp.Body.Close()
+	if !r.adoptFull {
+		r.refuseRanges()
+		return nil, ErrRangeNotSupported
+	}
+	if resp.ContentLength >= 0 && !r.fullBodyFits(resp.ContentLength) {
+		return nil, fmt.Errorf("%w: size %d, full body of %d", ErrInconsistentSize, r.lockedSize(), resp.ContentLength)
+	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	copy(buf, body)
-	if len(buf) == 0 {
-		// Can this happen?
-		return n, io.EOF
+	if !r.fullBodyFits(int64(len(body))) {
+		return nil, fmt.Errorf("%w: size %d, full body of %d", ErrInconsistentSize, r.lockedSize(), len(body))
 	}
+	r.mu.Lock()
+	r.inline = true
+	r.head = body
+	r.contentSize = int64(len(body))
+	r.mu.Unlock()
+	return r.inlineRange(start, end)
+}
 
-	return len(buf), nil
+// fullBodyFits reports whether a 200 body of n bytes can be the file: its
+// known size, or at least that under WithStaleSize where it may have grown.
+// An error page in place of the file doesn't fit
+func (r *Reader) fullBodyFits(n int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.contentSize < 0 {
+		return true
+	}
+	return n == r.contentSize || r.sizeStale && n > r.contentSize
 }
 
-// TODO can technically skip this if prefetch is set
-func (r *Reader) size() (contentSize int64, err error) {
-	req, err := http.NewRequest(http.MethodHead, r.url, nil)
+// checkContentRange rejects the Content-Range of a 206 that is missing,
+// unparsable or in the wrong unit. WithLenientContentRange lets the first
+// two through
+func (r *Reader) checkContentRange(cr string) error {
+	if cr == "" {
+		if r.lenientContentRange {
+			return nil
+		}
+		return ErrMissingContentRange
+	}
+	if !strings.HasPrefix(cr, r.rangeUnit+" ") {
+		return fmt.Errorf("Bad Content-Range unit, want %q: %q", r.rangeUnit, cr)
+	}
+	if _, _, _, err := parseContentRange(cr, r.rangeUnit); err != nil && !r.lenientContentRange {
+		return fmt.Errorf("%w: %v", ErrMissingContentRange, err)
+	}
+	return nil
+}
+
+// checkRangeOffsets rejects a 206 whose Content-Range doesn't start at start
+// or runs past end, -1 for the end of the file. A Content-Range let through
+// unparsed by WithLenientContentRange can't be checked. A range ending early
+// is left to the caller, which sees a short body
+func (r *Reader) checkRangeOffsets(cr string, start, end int64) error {
+	first, last, _, err := parseContentRange(cr, r.rangeUnit)
+	if err != nil || start < 0 {
+		return nil
+	}
+	if first != start || (end >= 0 && last > end-1) {
+		return fmt.Errorf("%w: asked for %d-%d, got %q", ErrRangeMismatch, start, end-1, cr)
+	}
+	return nil
+}
+
+// refuseRanges records that the server doesn't serve ranges, so later range
+// reads fail without a request
+func (r *Reader) refuseRanges() {
+	r.mu.Lock()
+	r.rangesRefused = true
+	r.mu.Unlock()
+}
+
+// refusesRanges reports whether the server is known not to serve ranges
+func (r *Reader) refusesRanges() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rangesRefused
+}
+
+// reconcileSize trusts the total of a range response over the HEAD's
+// Content-Length, some origins disagree between the two. A total that is
+// off by more than inconsistentSizeRatio is treated as a lie
+func (r *Reader) reconcileSize(contentRange string) error {
+	_, _, total, err := parseContentRange(contentRange, r.rangeUnit)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil || total < 0 || total == r.contentSize {
+		return nil
+	}
+	if !r.sizeStale && r.contentSize > 0 &&
+		(total > r.contentSize*inconsistentSizeRatio || total*inconsistentSizeRatio < r.contentSize) {
+		return fmt.Errorf("%w: size %d, Content-Range total %d", ErrInconsistentSize, r.contentSize, total)
+	}
+	r.contentSize = total
+	return nil
+}
+
+// parseContentRange parses a "unit first-last/total" Content-Range value,
+// the unit normally being "bytes". total is -1 when the server sends "*"
+func parseContentRange(s, unit string) (first, last, total int64, err error) {
+	got, spec, ok := strings.Cut(s, " ")
+	if !ok || got != unit {
+		return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+	}
+	span, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+	}
+	total = -1
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+		}
+	}
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+	}
+	if first, err = strconv.ParseInt(from, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+	}
+	if last, err = strconv.ParseInt(to, 10, 64); err != nil || last < first {
+		return 0, 0, 0, fmt.Errorf("Bad Content-Range: %q", s)
+	}
+	return first, last, total, nil
+}
+
+// newRequest builds a GET for the bytes in [start, end), or from start to
+// the end of the file when end is -1. A negative start with an end of -1
+// asks for the last -start bytes
+func (r *Reader) newRequest(ctx context.Context, start, end int64) (*http.Request, error) {
+	url, err := r.requestURL(ctx)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if r.resolver != nil {
+		if url, err = r.resolver(url, start, end); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
 	}
+	if start < 0 {
+		req.Header.Set("Range", fmt.Sprintf("%s=%d", r.rangeUnit, start))
+	} else if end < 0 {
+		req.Header.Set("Range", fmt.Sprintf("%s=%d-", r.rangeUnit, start))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("%s=%d-%d", r.rangeUnit, start, end-1))
+	}
+	return req, nil
+}
+
+// logicalSize is the length of the content as seen through Read and Seek
+func (r *Reader) logicalSize() int64 {
+	if r.gzip != nil {
+		return r.gzip.Size
+	}
+	return r.contentSize
+}
+
+// lockedSize reads contentSize while fetches may be running concurrently
+func (r *Reader) lockedSize() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.contentSize
+}
 
-	resp, err := r.client.Do(req)
+// sizeTrusted reports whether contentSize can be used to short-circuit
+// reads past the end of the file
+func (r *Reader) sizeTrusted() bool {
+	return !r.sizeStale && r.contentSize >= 0
+}
+
+// Size returns the size of the file, -1 while it is unknown. In gzip mode
+// it is the decompressed size
+func (r *Reader) Size() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logicalSize()
+}
+
+// PrefetchError returns why prefetching the head failed when the reader was
+// created, nil if it succeeded or none was asked for. The reader works
+// without the head, reads of it just go to the server
+func (r *Reader) PrefetchError() error {
+	return r.prefetchErr
+}
+
+// Section returns an io.SectionReader over the n bytes at offset. It reads
+// with ReadAt, so it has its own cursor and leaves r's alone
+func (r *Reader) Section(offset, n int64) *io.SectionReader {
+	return io.NewSectionReader(r, offset, n)
+}
+
+// State is a snapshot of a reader's cursor and metadata for debugging
+type State struct {
+	Offset       int64
+	ContentSize  int64
+	HeadCacheLen int
+	URL          string
+	ResolvedURL  string
+}
+
+// State returns a consistent snapshot of the reader. It only observes, and
+// is safe to call while another goroutine reads
+func (r *Reader) State() State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return State{
+		Offset:       r.offset,
+		ContentSize:  r.contentSize,
+		HeadCacheLen: len(r.head),
+		URL:          r.url,
+		ResolvedURL:  r.resolvedURL,
+	}
+}
+
+// Clone returns a reader over the same url with its own offset, starting at
+// 0, and fresh Stats counters. It shares the size, client, options, head and
+// any cache with r without repeating the HEAD, as well as the WithMaxRequests
+// budget and WithMaxInFlight slots, which hold across r and all its clones.
+// Clones may be used concurrently with each other, each one on its own
+// goroutine
+func (r *Reader) Clone() *Reader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := &Reader{readerState: r.readerState}
+	c.ctx, c.cancel = context.WithCancel(r.ctx)
+	c.offset = 0
+	c.consumed = 0
+	c.requests = 0
+	c.retried = 0
+	return c
+}
+
+// Stats returns a snapshot of the reader's counters
+func (r *Reader) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cached := int64(len(r.head))
+	if r.privateCache != nil {
+		cached += r.privateCache.Bytes()
+	}
+	return Stats{
+		Requests:    r.requests,
+		CachedBytes: cached,
+		Retries:     r.retried,
+	}
+}
+
+// do sends req, answering a 401 challenge once if an auth handler is set
+func (r *Reader) do(req *http.Request) (*http.Response, error) {
+	for name, values := range r.headers {
+		if name != "Range" {
+			req.Header[name] = values
+		}
+	}
+	if r.accept != "" {
+		// The size probe and every range must negotiate the same representation
+		req.Header.Set("Accept", r.accept)
+	}
+	if r.transparentGzip {
+		// Asking ourselves keeps net/http from decoding behind our back, and
+		// lets the size probe see the encoding
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	r.mu.Lock()
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	r.mu.Unlock()
+	resp, err := r.sendRetry(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || r.authHandler == nil {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	auth, err := r.authHandler(challenge)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	// Remember the credentials so later requests don't need the round trip
+	r.mu.Lock()
+	r.authorization = auth
+	r.mu.Unlock()
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", auth)
+	return r.sendRetry(retry)
+}
+
+// send issues req with the reader's client, enforcing the request budget
+func (r *Reader) send(req *http.Request) (*http.Response, error) {
+	if r.maxRequests > 0 && atomic.AddInt64(r.budgetUsed, 1) > int64(r.maxRequests) {
+		return nil, ErrRequestBudgetExceeded
+	}
+	r.mu.Lock()
+	r.requests++
+	r.mu.Unlock()
+
+	if r.requestIDHeader != "" {
+		req.Header.Set(r.requestIDHeader, r.requestIDGen())
 	}
-	s := resp.Header.Get("Content-Length")
-	size, err := strconv.ParseInt(s, 10, 64)
+	applyReadHeaders(req)
+	release, err := r.acquireInFlight(req.Context())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	r.metrics.IncRequests()
+	sent := time.Now()
+	client := r.client
+	if c, ok := req.Context().Value(clientKey{}).(*http.Client); ok {
+		client = c
+	}
+	resp, err := client.Do(req)
+	r.metrics.ObserveLatency(time.Since(sent))
+	if err != nil {
+		release()
+	} else if r.inFlight != nil {
+		// The request holds its slot until the body is closed
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	}
+	if _, noop := r.metrics.(noopCollector); err == nil && !noop {
+		resp.Body = &metricsBody{ReadCloser: resp.Body, metrics: r.metrics}
+	}
+	if err == nil && resp.StatusCode/100 == 2 {
+		r.mu.Lock()
+		if r.resolvedURL == "" {
+			// resp.Request is the last request in any redirect chain
+			r.resolvedURL = resp.Request.URL.String()
+		}
+		r.mu.Unlock()
+	}
+	return resp, err
+}
+
+// ResolvedURL returns the url data was actually served from after following
+// redirects, or "" before the first successful request
+func (r *Reader) ResolvedURL() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resolvedURL
+}
 
-	return size, nil
+// requestURL is the url requests are sent to
+func (r *Reader) requestURL(ctx context.Context) (string, error) {
+	if err := r.refreshURL(ctx); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pinRedirect && r.resolvedURL != "" {
+		return r.resolvedURL, nil
+	}
+	return r.url, nil
 }
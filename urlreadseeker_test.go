@@ -0,0 +1,1356 @@
+package urlreadseeker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testData returns n bytes of a pattern that doesn't repeat on any small
+// power of two, so misplaced bytes show up
+func testData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7 % 251)
+	}
+	return b
+}
+
+// newServer serves data with range support, counting the requests it gets
+func newServer(t *testing.T, data []byte) (*httptest.Server, *int64) {
+	var requests int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func TestMaxRequests(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	// The HEAD is the first of the 3
+	r, err := NewReader(s.URL, 0, WithMaxRequests(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{100, 200} {
+		if _, err := r.ReadAt(buf, off); err != nil {
+			t.Fatalf("read at %d: %v", off, err)
+		}
+	}
+	if _, err := r.ReadAt(buf, 300); !errors.Is(err, ErrRequestBudgetExceeded) {
+		t.Fatalf("got %v, want ErrRequestBudgetExceeded", err)
+	}
+	if got := r.Stats().Requests; got != 3 {
+		t.Fatalf("got %d requests, want 3", got)
+	}
+}
+
+func TestPrefetchPastEnd(t *testing.T) {
+	data := testData(100)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.head, data) {
+		t.Fatalf("head is %d bytes, want the %d of the file", len(r.head), len(data))
+	}
+	before := atomic.LoadInt64(requests)
+	buf := make([]byte, 50)
+	if n, err := r.ReadAt(buf, 25); err != nil || n != 50 || !bytes.Equal(buf, data[25:75]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if atomic.LoadInt64(requests) != before {
+		t.Fatal("read within the head hit the server")
+	}
+}
+
+// growingServer serves a file that can be appended to while readers are open
+type growingServer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (g *growingServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	g.mu.Lock()
+	data := g.data
+	g.mu.Unlock()
+	http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+}
+
+func (g *growingServer) grow(data []byte) {
+	g.mu.Lock()
+	g.data = data
+	g.mu.Unlock()
+}
+
+func TestStaleSizeGrowth(t *testing.T) {
+	data := testData(200)
+	g := &growingServer{data: data[:100]}
+	s := httptest.NewServer(g)
+	defer s.Close()
+	r, err := NewReader(s.URL, 0, WithStaleSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.grow(data)
+	buf := make([]byte, 50)
+	if n, err := r.ReadAt(buf, 120); err != nil || n != 50 || !bytes.Equal(buf, data[120:170]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(buf, 180); err != io.EOF || n != 20 || !bytes.Equal(buf[:n], data[180:]) {
+		t.Fatalf("got %d, %v at the new end", n, err)
+	}
+}
+
+func TestReadAtIntoSharesBlock(t *testing.T) {
+	data := testData(100000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithSharedCache(NewMemoryCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.ReadAtInto(1000, 50)
+	if err != nil || !bytes.Equal(a, data[1000:1050]) {
+		t.Fatal(err)
+	}
+	b, err := r.ReadAtInto(1020, 50)
+	if err != nil || !bytes.Equal(b, data[1020:1070]) {
+		t.Fatal(err)
+	}
+	if &a[20] != &b[0] {
+		t.Fatal("overlapping reads of one block don't share memory")
+	}
+}
+
+func TestReadAtIntoBounds(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	// Within the head, which used to be sliced before any check
+	r, err := NewReader(s.URL, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAtInto(-1, 1); !errors.Is(err, ErrNegativeOffset) {
+		t.Fatalf("got %v, want ErrNegativeOffset", err)
+	}
+	if _, err := r.ReadAtInto(5, -2); err == nil {
+		t.Fatal("read a negative length, want an error")
+	}
+}
+
+func TestAuthChallenge(t *testing.T) {
+	data := testData(1000)
+	mux := http.NewServeMux()
+	var tokens int64
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&tokens, 1)
+		if req.URL.Query().Get("service") != "registry" {
+			http.Error(w, "bad service", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("secret"))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	mux.HandleFunc("/blob", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+s.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, req, "blob", time.Time{}, bytes.NewReader(data))
+	})
+
+	handler := func(challenge string) (string, error) {
+		params := map[string]string{}
+		for _, p := range strings.Split(strings.TrimPrefix(challenge, "Bearer "), ",") {
+			k, v, _ := strings.Cut(p, "=")
+			params[k] = strings.Trim(v, `"`)
+		}
+		resp, err := http.Get(params["realm"] + "?service=" + params["service"])
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		token, err := ioutil.ReadAll(resp.Body)
+		return "Bearer " + string(token), err
+	}
+	r, err := NewReader(s.URL+"/blob", 0, WithAuthChallengeHandler(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	for _, off := range []int64{0, 500} {
+		if n, err := r.ReadAt(buf, off); err != nil || !bytes.Equal(buf[:n], data[off:off+100]) {
+			t.Fatalf("read at %d: %d, %v", off, n, err)
+		}
+	}
+	if got := atomic.LoadInt64(&tokens); got != 1 {
+		t.Fatalf("fetched %d tokens, want 1", got)
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, header, err := r.OpenRange(context.Background(), 100, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	var got bytes.Buffer
+	if _, err := io.Copy(&got, body); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), data[100:300]) {
+		t.Fatalf("got %d bytes of the wrong range", got.Len())
+	}
+	if cr := header.Get("Content-Range"); cr != "bytes 100-299/1000" {
+		t.Fatalf("Content-Range %q", cr)
+	}
+}
+
+func TestInvalidURL(t *testing.T) {
+	for _, url := range []string{"", "/relative/path", "ftp://example.com/file"} {
+		if _, err := NewReader(url, 0); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("%q: got %v, want ErrInvalidURL", url, err)
+		}
+	}
+}
+
+func TestCopyN(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if n, err := r.CopyN(&out, 300); err != nil || n != 300 || !bytes.Equal(out.Bytes(), data[100:400]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if r.State().Offset != 400 {
+		t.Fatalf("offset %d after the copy", r.State().Offset)
+	}
+	out.Reset()
+	if _, err := r.Seek(900, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.CopyN(&out, 300); err != io.EOF || n != 100 || !bytes.Equal(out.Bytes(), data[900:]) {
+		t.Fatalf("got %d, %v near the end", n, err)
+	}
+}
+
+func TestResolvedURL(t *testing.T) {
+	data := testData(1000)
+	target, _ := newServer(t, data)
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, target.URL+"/final", http.StatusFound)
+	}))
+	defer redirect.Close()
+	r, err := NewReader(redirect.URL+"/start", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.ResolvedURL(); got != target.URL+"/final" {
+		t.Fatalf("resolved to %q", got)
+	}
+}
+
+func TestConstructionCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := NewReaderContext(ctx, s.URL, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("took %v to give up", elapsed)
+	}
+}
+
+// lyingHeadServer serves data to GETs while its HEAD reports headSize
+func lyingHeadServer(t *testing.T, data []byte, headSize string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.Header().Set("Content-Length", headSize)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestReconcileSize(t *testing.T) {
+	data := testData(1200)
+	s := lyingHeadServer(t, data, "1000")
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != 1000 {
+		t.Fatalf("size %d before any range", r.Size())
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 500); err != nil || !bytes.Equal(buf[:n], data[500:600]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d, want the Content-Range total %d", r.Size(), len(data))
+	}
+	if n, err := r.ReadAt(buf, 1100); err != nil || !bytes.Equal(buf[:n], data[1100:]) {
+		t.Fatalf("got %d, %v past the HEAD's size", n, err)
+	}
+}
+
+func TestEndpointResolver(t *testing.T) {
+	data := testData(1000)
+	low, lowRequests := newServer(t, data)
+	high, highRequests := newServer(t, data)
+	resolve := func(url string, start, end int64) (string, error) {
+		if start >= 500 {
+			return high.URL, nil
+		}
+		return low.URL, nil
+	}
+	r, err := NewReader(low.URL, 0, WithEndpointResolver(resolve))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lowBefore := atomic.LoadInt64(lowRequests)
+	buf := make([]byte, 100)
+	for _, off := range []int64{100, 600, 800} {
+		if n, err := r.ReadAt(buf, off); err != nil || !bytes.Equal(buf[:n], data[off:off+100]) {
+			t.Fatalf("read at %d: %d, %v", off, n, err)
+		}
+	}
+	if got := atomic.LoadInt64(lowRequests) - lowBefore; got != 1 {
+		t.Errorf("%d ranges on the low mirror, want 1", got)
+	}
+	if got := atomic.LoadInt64(highRequests); got != 2 {
+		t.Errorf("%d ranges on the high mirror, want 2", got)
+	}
+}
+
+// noRangeServer answers every GET with 200 and the whole of data
+func noRangeServer(t *testing.T, data []byte) (*httptest.Server, *int64) {
+	var requests int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func TestFullBodyResponses(t *testing.T) {
+	data := testData(1000)
+	s, requests := noRangeServer(t, data)
+	buf := make([]byte, 100)
+
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(buf, 100); !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("got %v, want ErrRangeNotSupported", err)
+	}
+
+	r, err = NewReader(s.URL, 0, WithAdoptFullBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadAt(buf, 100); err != nil || !bytes.Equal(buf[:n], data[100:200]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	before := atomic.LoadInt64(requests)
+	if n, err := r.ReadAt(buf, 800); err != nil || !bytes.Equal(buf[:n], data[800:900]) {
+		t.Fatalf("got %d, %v from the adopted body", n, err)
+	}
+	if atomic.LoadInt64(requests) != before {
+		t.Fatal("read of the adopted body hit the server")
+	}
+}
+
+func TestFullBodyWrongSize(t *testing.T) {
+	data := testData(1000)
+	page := []byte("<html>Not here</html>\n")
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		// A 200 for a range, but with an error page rather than the file
+		w.Write(page)
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithAdoptFullBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, 5); !errors.Is(err, ErrInconsistentSize) {
+		t.Fatalf("got %v, want ErrInconsistentSize", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d after the error page, want %d", r.Size(), len(data))
+	}
+}
+
+func TestReadAtLeast(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 200)
+	if n, err := r.ReadAtLeast(buf, 150); err != nil || n < 150 || !bytes.Equal(buf[:n], data[:n]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+
+	if _, err := r.Seek(950, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadAtLeast(buf, 100); err != io.ErrUnexpectedEOF || n != 50 || !bytes.Equal(buf[:n], data[950:]) {
+		t.Fatalf("got %d, %v at the end, want 50, io.ErrUnexpectedEOF", n, err)
+	}
+
+	if n, err := r.ReadAtLeast(buf[:10], 20); err != io.ErrShortBuffer || n != 0 {
+		t.Fatalf("got %d, %v for min past the buffer", n, err)
+	}
+}
+
+func TestCloneConcurrent(t *testing.T) {
+	data := testData(100000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 1000, WithSharedCache(NewMemoryCache()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for _, start := range []int64{0, 50000} {
+		wg.Add(1)
+		go func(c *Reader, start int64) {
+			defer wg.Done()
+			if _, err := c.Seek(start, io.SeekStart); err != nil {
+				t.Error(err)
+				return
+			}
+			buf := make([]byte, 1000)
+			for pos := start; pos < start+50000; pos += 1000 {
+				if _, err := io.ReadFull(c, buf); err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(buf, data[pos:pos+1000]) {
+					t.Errorf("clone at %d got the wrong bytes", pos)
+					return
+				}
+			}
+		}(r.Clone(), start)
+	}
+	wg.Wait()
+	if r.State().Offset != 0 {
+		t.Fatal("clones moved the original's offset")
+	}
+}
+
+func TestCloneSharesBudget(t *testing.T) {
+	s, _ := newServer(t, testData(1000))
+	r, err := NewReader(s.URL, 0, WithMaxRequests(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{100, 200} {
+		if _, err := r.Clone().ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Clone().ReadAt(buf, 300); !errors.Is(err, ErrRequestBudgetExceeded) {
+		t.Fatalf("a fresh clone got %v, want ErrRequestBudgetExceeded", err)
+	}
+}
+
+func TestMaxRangeSize(t *testing.T) {
+	data := testData(10 << 20)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithMaxRangeSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	buf := make([]byte, len(data))
+	if n, err := r.ReadAt(buf, 0); err != nil || n != len(data) || !bytes.Equal(buf, data) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 10 {
+		t.Fatalf("%d requests, want 10", got)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	formats := map[string][]byte{
+		"application/json":         []byte(`{"compact":true}`),
+		"application/octet-stream": testData(1000),
+	}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, ok := formats[req.Header.Get("Accept")]
+		if !ok {
+			body = formats["application/octet-stream"]
+		}
+		w.Header().Set("Vary", "Accept")
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(body))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0, WithAccept("application/json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := formats["application/json"]
+	if r.Size() != int64(len(want)) {
+		t.Fatalf("size %d, want the json's %d", r.Size(), len(want))
+	}
+	buf := make([]byte, 8)
+	if n, err := r.ReadAt(buf, 2); err != nil || !bytes.Equal(buf[:n], want[2:10]) {
+		t.Fatalf("got %q, %v", buf[:n], err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	data := testData(100000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	body, err := r.Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	got, err := ioutil.ReadAll(body)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	if n := atomic.LoadInt64(requests) - before; n != 1 {
+		t.Fatalf("%d requests, want one GET", n)
+	}
+}
+
+func TestReadAtOversizedBuffer(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	n, err := r.ReadAt(buf, 990)
+	if n != 10 || err != io.EOF || !bytes.Equal(buf[:n], data[990:]) {
+		t.Fatalf("got %d, %v, want 10, io.EOF", n, err)
+	}
+}
+
+// BenchmarkRead measures a tight loop of uncached reads, whose scratch
+// buffers come from bodyPool
+func BenchmarkRead(b *testing.B) {
+	data := testData(1 << 20)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 64*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		off := int64(i%16) * int64(len(buf))
+		if _, err := r.ReadAt(buf, off); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRangeUnit(t *testing.T) {
+	data := testData(1000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Accept-Ranges", "items")
+		if req.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		unit, first, last, ok := parseRangeSpec(req.Header.Get("Range"), int64(len(data)))
+		if !ok || unit != "items" {
+			http.Error(w, "only items ranges", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("items %d-%d/%d", first, last, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[first : last+1])
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0, WithRangeUnit("items"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 450); err != nil || !bytes.Equal(buf[:n], data[450:550]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+}
+
+// stallingServer sends the first 100 bytes of every GET and then stalls
+// until the client goes away
+func stallingServer(t *testing.T, data []byte) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodHead {
+			return
+		}
+		w.Write(data[:100])
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCloseCancelsWriteTo(t *testing.T) {
+	s := stallingServer(t, testData(100000))
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.WriteTo(ioutil.Discard)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WriteTo still running after Close")
+	}
+}
+
+func TestStateOffset(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	steps := []struct {
+		do   func() error
+		want int64
+	}{
+		{func() error { _, err := r.Read(buf); return err }, 100},
+		{func() error { _, err := r.Seek(50, io.SeekCurrent); return err }, 150},
+		{func() error { _, err := r.Read(buf); return err }, 250},
+		{func() error { _, err := r.Seek(-100, io.SeekEnd); return err }, 900},
+		{func() error { _, err := r.ReadAt(buf, 0); return err }, 900},
+		{func() error { _, err := r.Seek(10, io.SeekStart); return err }, 10},
+	}
+	for i, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if state := r.State(); state.Offset != step.want || state.ContentSize != 1000 {
+			t.Fatalf("step %d: offset %d, size %d, want offset %d", i, state.Offset, state.ContentSize, step.want)
+		}
+	}
+}
+
+func TestRangeSplitting(t *testing.T) {
+	data := testData(1 << 20)
+	var rejected int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, first, last, ok := parseRangeSpec(req.Header.Get("Range"), int64(len(data)))
+		if ok && last-first+1 > 64*1024 {
+			atomic.AddInt64(&rejected, 1)
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 500000)
+	if n, err := r.ReadAt(buf, 100000); err != nil || !bytes.Equal(buf[:n], data[100000:600000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	rejectedFirst := atomic.LoadInt64(&rejected)
+	if rejectedFirst == 0 {
+		t.Fatal("the server never rejected a range")
+	}
+	if n, err := r.ReadAt(buf, 500000); err != nil || !bytes.Equal(buf[:n], data[500000:1000000]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if atomic.LoadInt64(&rejected) != rejectedFirst {
+		t.Fatal("the learned range limit wasn't kept")
+	}
+}
+
+func TestReadEmptyBuffer(t *testing.T) {
+	s, requests := newServer(t, testData(1000))
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	for _, buf := range [][]byte{nil, {}} {
+		if n, err := r.Read(buf); n != 0 || err != nil {
+			t.Fatalf("Read(%v) got %d, %v, want 0, nil", buf, n, err)
+		}
+	}
+	if atomic.LoadInt64(requests) != before {
+		t.Fatal("an empty read hit the server")
+	}
+}
+
+func TestVerifyComplete(t *testing.T) {
+	data := testData(10000)
+	s, _ := newServer(t, data)
+
+	r, err := NewReader(s.URL, 0, WithVerifyComplete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("full read: Close got %v", err)
+	}
+
+	r, err = NewReader(s.URL, 0, WithVerifyComplete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, 5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); !errors.Is(err, ErrIncompleteRead) {
+		t.Fatalf("partial read: Close got %v, want ErrIncompleteRead", err)
+	}
+}
+
+func TestOpenFrom(t *testing.T) {
+	data := testData(1000)
+	var ranges []string
+	var mu sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, req.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := r.OpenFrom(context.Background(), 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	got, err := ioutil.ReadAll(body)
+	if err != nil || !bytes.Equal(got, data[600:]) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last := ranges[len(ranges)-1]; last != "bytes=600-" {
+		t.Fatalf("sent Range %q, want an open-ended range", last)
+	}
+}
+
+// readFromRecorder is a file that records whether its ReadFrom was used
+type readFromRecorder struct {
+	*os.File
+	readFrom bool
+}
+
+func (f *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	f.readFrom = true
+	return f.File.ReadFrom(src)
+}
+
+func TestWriteToReaderFrom(t *testing.T) {
+	data := testData(100000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "copy")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := &readFromRecorder{File: file}
+	if n, err := io.Copy(dst, r); err != nil || n != int64(len(data)) {
+		t.Fatalf("copied %d, %v", n, err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !dst.readFrom {
+		t.Fatal("the file's ReadFrom wasn't used")
+	}
+	if got, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("file holds %d bytes, %v", len(got), err)
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	data := testData(1000)
+	var mu sync.Mutex
+	var ids []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		ids = append(ids, req.Header.Get("X-Request-Id"))
+		mu.Unlock()
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	var next int64
+	gen := func() string {
+		return "req-" + strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+	}
+	r, err := NewReader(s.URL, 0, WithRequestIDHeader("X-Request-Id", gen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	for _, off := range []int64{0, 100, 200} {
+		if _, err := r.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"req-1", "req-2", "req-3", "req-4"}
+	if strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Fatalf("request ids %q, want %q", ids, want)
+	}
+}
+
+func TestReadWithinHead(t *testing.T) {
+	data := testData(1000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := atomic.LoadInt64(requests)
+	buf := make([]byte, 100)
+	if n, err := r.ReadAt(buf, 0); err != nil || n != 100 || !bytes.Equal(buf, data[:100]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if atomic.LoadInt64(requests) != before {
+		t.Fatal("read of exactly the head hit the server")
+	}
+	if n, err := r.ReadAt(buf, 50); err != nil || n != 100 || !bytes.Equal(buf, data[50:150]) {
+		t.Fatalf("read across the head's end got %d, %v", n, err)
+	}
+	for _, off := range []int64{-3, -500} {
+		if _, err := r.ReadAt(buf, off); !errors.Is(err, ErrNegativeOffset) {
+			t.Fatalf("read at %d got %v, want ErrNegativeOffset", off, err)
+		}
+	}
+	empty, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := empty.ReadAt(buf, -3); !errors.Is(err, ErrNegativeOffset) {
+		t.Fatalf("read at -3 without a head got %v", err)
+	}
+}
+
+func TestOnChunk(t *testing.T) {
+	data := testData(100000)
+	s, _ := newServer(t, data)
+	rebuilt := make([]byte, len(data))
+	var chunks int
+	onChunk := func(start int64, chunk []byte) {
+		chunks++
+		copy(rebuilt[start:], chunk)
+	}
+	r, err := NewReader(s.URL, 0, WithOnChunk(onChunk), WithMaxRangeSize(30000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 25000)
+	for off := int64(0); off < int64(len(data)); off += int64(len(buf)) {
+		if _, err := r.ReadAt(buf, off); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(rebuilt, data) {
+		t.Fatal("chunks don't add up to the file")
+	}
+	if chunks < 4 {
+		t.Fatalf("%d chunks for 4 reads", chunks)
+	}
+}
+
+// contentRangeServer answers ranges with 206, the bytes asked for and the
+// Content-Range returned by contentRange, "" for none
+func contentRangeServer(t *testing.T, data []byte, contentRange func(first, last int64) string) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodHead {
+			return
+		}
+		_, first, last, ok := parseRangeSpec(req.Header.Get("Range"), int64(len(data)))
+		if !ok {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if cr := contentRange(first, last); cr != "" {
+			w.Header().Set("Content-Range", cr)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[first : last+1])
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMissingContentRange(t *testing.T) {
+	data := testData(1000)
+	s := contentRangeServer(t, data, func(first, last int64) string { return "" })
+	buf := make([]byte, 100)
+
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(buf, 300); !errors.Is(err, ErrMissingContentRange) {
+		t.Fatalf("got %v, want ErrMissingContentRange", err)
+	}
+	if _, err := r.ReadTail(10); !errors.Is(err, ErrMissingContentRange) {
+		t.Fatalf("tail got %v, want ErrMissingContentRange", err)
+	}
+	if _, err := r.OpenFrom(context.Background(), 300); !errors.Is(err, ErrMissingContentRange) {
+		t.Fatalf("OpenFrom got %v, want ErrMissingContentRange", err)
+	}
+
+	r, err = NewReader(s.URL, 0, WithLenientContentRange())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.ReadAt(buf, 300); err != nil || !bytes.Equal(buf[:n], data[300:400]) {
+		t.Fatalf("lenient got %d, %v", n, err)
+	}
+}
+
+func TestSuffixRangeMismatch(t *testing.T) {
+	s := contentRangeServer(t, testData(1000), func(first, last int64) string {
+		// Claims the bytes end short of the file
+		return fmt.Sprintf("bytes %d-%d/1000", first-1, last-1)
+	})
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadTail(10); !errors.Is(err, ErrRangeMismatch) {
+		t.Fatalf("got %v, want ErrRangeMismatch", err)
+	}
+}
+
+func TestReadAtDeadline(t *testing.T) {
+	data := testData(100000)
+	// Sends the first 100 bytes of the range, then nothing
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodHead {
+			return
+		}
+		_, first, last, _ := parseRangeSpec(req.Header.Get("Range"), int64(len(data)))
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+		w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[first : first+100])
+		w.(http.Flusher).Flush()
+		<-req.Context().Done()
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1000)
+	start := time.Now()
+	n, err := r.ReadAtDeadline(buf, 500, start.Add(100*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("took %v to give up", elapsed)
+	}
+	if n != 100 || !bytes.Equal(buf[:n], data[500:600]) {
+		t.Fatalf("got %d bytes, want the 100 sent in time", n)
+	}
+}
+
+// maxWriter records the largest write it is given
+type maxWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestCopyBufferSize(t *testing.T) {
+	data := testData(100000)
+	s, _ := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithCopyBufferSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &maxWriter{}
+	if _, err := r.WriteTo(w); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.Bytes(), data) {
+		t.Fatalf("wrote %d bytes, want the %d of the file", w.Len(), len(data))
+	}
+	if w.max > 1000 {
+		t.Fatalf("largest write %d bytes, want at most 1000", w.max)
+	}
+	if _, err := NewReader(s.URL, 0, WithCopyBufferSize(0)); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("got %v, want ErrInvalidOption", err)
+	}
+}
+
+func TestReadvAt(t *testing.T) {
+	data := testData(10000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufs := [][]byte{make([]byte, 10), make([]byte, 0), make([]byte, 500), make([]byte, 90)}
+	before := atomic.LoadInt64(requests)
+	n, err := r.ReadvAt(1000, bufs)
+	if err != nil || n != 600 {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if got := atomic.LoadInt64(requests) - before; got != 1 {
+		t.Fatalf("sent %d requests, want 1", got)
+	}
+	off := 1000
+	for i, buf := range bufs {
+		if !bytes.Equal(buf, data[off:off+len(buf)]) {
+			t.Fatalf("buffer %d has the wrong bytes", i)
+		}
+		off += len(buf)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	data := testData(1000)
+	s, _ := newServer(t, data)
+	lenient, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, err := NewReader(s.URL, 0, WithSeekValidation())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if off, err := lenient.Seek(2000, io.SeekStart); err != nil || off != 2000 {
+		t.Fatalf("lenient seek past the end: %d, %v", off, err)
+	}
+	if n, err := lenient.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+		t.Fatalf("read past the end: %d, %v", n, err)
+	}
+	if off, err := strict.Seek(2000, io.SeekStart); !errors.Is(err, ErrSeekOutOfBounds) || off != 0 {
+		t.Fatalf("strict seek past the end: %d, %v", off, err)
+	}
+	if off, err := strict.Seek(1000, io.SeekStart); err != nil || off != 1000 {
+		t.Fatalf("strict seek to the end: %d, %v", off, err)
+	}
+
+	for _, r := range []*Reader{lenient, strict} {
+		off, err := r.Seek(-10, io.SeekEnd)
+		if err != nil || off != 990 {
+			t.Fatalf("seek 10 from the end: %d, %v", off, err)
+		}
+		buf := make([]byte, 10)
+		if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, data[990:]) {
+			t.Fatalf("read the last 10 bytes: %v", err)
+		}
+		if off, err := r.Seek(-2000, io.SeekEnd); !errors.Is(err, ErrNegativeOffset) || off != 1000 {
+			t.Fatalf("seek before the start: %d, %v", off, err)
+		}
+		if _, err := r.Seek(-1, io.SeekStart); !errors.Is(err, ErrNegativeOffset) {
+			t.Fatalf("seek to -1: %v", err)
+		}
+	}
+}
+
+func TestRangeResponseValidator(t *testing.T) {
+	data := testData(10000)
+	// Answers ranges with a 200 that still says which bytes it sent
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodHead {
+			return
+		}
+		_, first, last, ok := parseRangeSpec(req.Header.Get("Range"), int64(len(data)))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if first < 8000 {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(last-first+1, 10))
+		w.Write(data[first : last+1])
+	}))
+	t.Cleanup(s.Close)
+	errNoRange := errors.New("no Content-Range")
+	validate := func(resp *http.Response, reqStart, reqEnd int64) (int64, error) {
+		if resp.Header.Get("Content-Range") == "" {
+			return 0, errNoRange
+		}
+		first, _, _, err := parseContentRange(resp.Header.Get("Content-Range"), "bytes")
+		return first, err
+	}
+	r, err := NewReader(s.URL, 0, WithRangeResponseValidator(validate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	if _, err := r.ReadAt(buf, 4000); err != nil || !bytes.Equal(buf, data[4000:4100]) {
+		t.Fatalf("read through the validator: %v", err)
+	}
+	if _, err := r.ReadAt(buf, 9000); !errors.Is(err, errNoRange) {
+		t.Fatalf("got %v, want the validator's error", err)
+	}
+}
+
+func TestSmallFileThreshold(t *testing.T) {
+	data := testData(1000)
+	s, requests := newServer(t, data)
+	r, err := NewReader(s.URL, 0, WithSmallFileThreshold(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The HEAD and the GET of the whole file
+	if n := atomic.LoadInt64(requests); n != 2 {
+		t.Fatalf("got %d requests opening, want 2", n)
+	}
+	buf := make([]byte, 100)
+	if _, err := r.ReadAt(buf, 900); err != nil || !bytes.Equal(buf, data[900:]) {
+		t.Fatalf("read the tail: %v", err)
+	}
+	if _, err := r.Seek(500, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := r.WriteTo(&out); err != nil || !bytes.Equal(out.Bytes(), data[500:]) {
+		t.Fatalf("write the rest: %v", err)
+	}
+	if n := atomic.LoadInt64(requests); n != 2 {
+		t.Fatalf("got %d requests, want the reads served from memory", n)
+	}
+}
+
+func TestSmallFileThresholdStaleSize(t *testing.T) {
+	data := testData(100)
+	g := &growingServer{}
+	s := httptest.NewServer(g)
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0, WithSmallFileThreshold(4096), WithStaleSize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.grow(data)
+	buf := make([]byte, 50)
+	if n, err := r.ReadAt(buf, 20); err != nil || n != 50 || !bytes.Equal(buf, data[20:70]) {
+		t.Fatalf("got %d, %v after the file grew", n, err)
+	}
+}
+
+func TestPrefetchError(t *testing.T) {
+	data := testData(1000)
+	failing := int32(1)
+	s, _ := failingServer(t, data, &failing)
+	r, err := NewReader(s.URL, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status *StatusError
+	if err := r.PrefetchError(); !errors.As(err, &status) {
+		t.Fatalf("prefetch error %v, want a *StatusError", err)
+	}
+	if _, err := NewReader(s.URL, 100, WithPrefetchRequired()); !errors.As(err, &status) {
+		t.Fatalf("got %v with the prefetch required, want a *StatusError", err)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	buf := make([]byte, 50)
+	if _, err := r.ReadAt(buf, 10); err != nil || !bytes.Equal(buf, data[10:60]) {
+		t.Fatalf("read after a failed prefetch: %v", err)
+	}
+	r, err = NewReader(s.URL, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.PrefetchError(); err != nil {
+		t.Fatalf("prefetch error %v, want nil", err)
+	}
+}
+
+func TestReaderWithOptions(t *testing.T) {
+	data := testData(1000)
+	var header atomic.Value
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header.Store(req.Header.Get("X-Test"))
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+	var sent int64
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt64(&sent, 1)
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	r, err := NewReaderWithOptions(context.Background(), s.URL, WithClient(client), WithHeader("X-Test", "yes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 20)
+	if n, err := r.ReadAtContext(context.Background(), buf, 100); err != nil || n != 20 || !bytes.Equal(buf, data[100:120]) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if atomic.LoadInt64(&sent) != 2 || header.Load() != "yes" {
+		t.Fatalf("client sent %d requests, header %v", atomic.LoadInt64(&sent), header.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.ReadAtContext(ctx, buf, 500); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if _, err := NewReaderWithOptions(context.Background(), s.URL, WithClient(client), WithMaxIdleConns(3)); !errors.Is(err, ErrOptionConflict) {
+		t.Fatalf("got %v, want ErrOptionConflict", err)
+	}
+}
+
+func TestAcceptRangesNone(t *testing.T) {
+	data := testData(1000)
+	var gets int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Accept-Ranges", "none")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if req.Method == http.MethodGet {
+			atomic.AddInt64(&gets, 1)
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(s.Close)
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, 100); !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("got %v, want ErrRangeNotSupported", err)
+	}
+	if n := atomic.LoadInt64(&gets); n != 0 {
+		t.Fatalf("sent %d GETs to a server refusing ranges", n)
+	}
+	r, err = NewReader(s.URL, 0, WithAdoptFullBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadAt(buf, 100); err != nil || !bytes.Equal(buf, data[100:110]) {
+		t.Fatalf("read adopting the full body: %v", err)
+	}
+}
+
+func TestRangeMismatch(t *testing.T) {
+	data := testData(1000)
+	// Answers every range with the first 10 bytes
+	s := contentRangeServer(t, data, func(first, last int64) string { return "bytes 0-9/1000" })
+	r, err := NewReader(s.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, 505); !errors.Is(err, ErrRangeMismatch) {
+		t.Fatalf("got %v, want ErrRangeMismatch", err)
+	}
+	if _, err := r.ReadAt(buf, 505); !errors.Is(err, ErrRangeNotSupported) {
+		t.Fatalf("got %v for the next read, want ErrRangeNotSupported", err)
+	}
+}
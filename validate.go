@@ -0,0 +1,50 @@
+package urlreadseeker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Validate checks that url can back a Reader: it is reachable, reports a
+// size and answers range requests, without building a Reader or fetching
+// any data beyond a single byte. An unreachable url returns the request
+// error, a *StatusError for a bad status. A missing size returns
+// ErrNoContentLength, unless opts include WithAllowUnknownSize, and a
+// server that ignores ranges returns ErrRangeNotSupported. Empty files
+// have no bytes to ask for and pass once their size is known
+func Validate(ctx context.Context, url string, opts ...Option) error {
+	r := newReader(ctx, url, opts)
+	defer r.cancel()
+	if err := r.prepare(); err != nil {
+		return err
+	}
+	if isDataURL(r.url) {
+		return r.loadDataURL()
+	}
+
+	size, err := r.size(r.ctx)
+	if errors.Is(err, ErrNoContentLength) && r.allowUnknownSize {
+		size, err = -1, nil
+	}
+	if err != nil {
+		return err
+	}
+	r.contentSize = size
+	if size == 0 || len(r.head) > 0 {
+		// The GET size probe already got a 206
+		return nil
+	}
+
+	// A full body is a failure here, not something to adopt
+	r.adoptFull = false
+	resp, err := r.openRange(r.ctx, 0, 1)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return ErrRangeNotSupported
+	}
+	return nil
+}
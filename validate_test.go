@@ -0,0 +1,49 @@
+package urlreadseeker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	data := testData(1000)
+	good, _ := newServer(t, data)
+	if err := Validate(ctx, good.URL); err != nil {
+		t.Fatalf("good server: %v", err)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	var status *StatusError
+	if err := Validate(ctx, missing.URL); !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: got %v", err)
+	}
+
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+	if err := Validate(ctx, gone.URL); !errors.Is(err, ErrConnect) {
+		t.Errorf("unreachable server: got %v", err)
+	}
+
+	unsized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Streamed with no length, and ranges ignored
+		w.(http.Flusher).Flush()
+		w.Write(data)
+	}))
+	defer unsized.Close()
+	if err := Validate(ctx, unsized.URL); !errors.Is(err, ErrNoContentLength) {
+		t.Errorf("no size: got %v", err)
+	}
+
+	whole, _ := noRangeServer(t, data)
+	if err := Validate(ctx, whole.URL); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("ranges ignored: got %v", err)
+	}
+	if err := Validate(ctx, whole.URL, WithAdoptFullBody()); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("ranges ignored under WithAdoptFullBody: got %v", err)
+	}
+}